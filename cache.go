@@ -19,17 +19,18 @@ func newCache() *cache {
 type mapperEntry struct {
 	columns []string
 	dst     reflect.Type
+	opts    string // key of mapping options
 }
 
 func (m *mapperEntry) raw() string {
 	// TODO: test how this works with unexported types
 	// TODO: add a way to provide fully qualified name for the type, since m.typ is always a pointer to a struct or slice
 	// return strings.Join(m.columns, ",") + "|" + m.dst.PkgPath() + "." + m.dst.String()
-	return strings.Join(m.columns, ",") + "|" + m.dst.String()
+	return strings.Join(m.columns, ",") + "|" + m.dst.String() + "|" + m.opts
 }
 
-func (c *cache) loadMap(columns []string, dst reflect.Type) (mapper *Mapper, ok bool) {
-	entry := mapperEntry{columns, dst}
+func (c *cache) loadMap(columns []string, dst reflect.Type, opts *options) (mapper *Mapper, ok bool) {
+	entry := mapperEntry{columns, dst, opts.key()}
 	vmap, ok := c.mapCache.Load(entry.raw())
 	if ok {
 		mapper = vmap.(*Mapper)
@@ -37,7 +38,7 @@ func (c *cache) loadMap(columns []string, dst reflect.Type) (mapper *Mapper, ok
 	return
 }
 
-func (c *cache) storeMap(columns []string, dst reflect.Type, mapper *Mapper) {
-	entry := mapperEntry{columns, dst}
+func (c *cache) storeMap(columns []string, dst reflect.Type, opts *options, mapper *Mapper) {
+	entry := mapperEntry{columns, dst, opts.key()}
 	c.mapCache.Store(entry.raw(), mapper)
 }
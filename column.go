@@ -1,100 +1,391 @@
 package carta
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
 	"sort"
 	"strings"
 )
 
 // column represents the ith struct field of this mapper where the column is to be mapped
 type column struct {
-	typ         *sql.ColumnType
+	typ         string // database type name of the column
 	name        string
 	columnIndex int
 	i           fieldIndex
 }
 
-func allocateColumns(m *Mapper, columns map[string]column) error {
-	var (
-		candidates map[string]bool
-	)
+// allocateColumns assigns columns to the fields of the mapper tree, a column is claimed by at most one field.
+// Allocation is deterministic, fields of shallower structs take precedence over fields of nested structs,
+// and fields of the same struct, as well as sibling structs, take precedence in the order they are declared.
+// Variants of polymorphic mappers allocate their whole tree from a copy of the remaining columns, see allocateVariantColumns
+func allocateColumns(root *Mapper, columns map[string]column) error {
+	all := make(map[string]column, len(columns))
+	for name, c := range columns {
+		all[name] = c
+	}
+	return allocatePoolColumns(root, columns, all)
+}
+
+// allocatePoolColumns assigns columns of the pool to the mapper tree, all holds every column of the rows,
+// including claimed ones, which key columns of basic collections are looked up in
+func allocatePoolColumns(root *Mapper, columns map[string]column, all map[string]column) error {
+	level := []*Mapper{root}
+	for len(level) != 0 {
+		next := []*Mapper{}
+		for _, m := range level {
+			if err := allocateMapperColumns(m, columns, all); err != nil {
+				return err
+			}
+			for _, i := range sortedSubMapIndexes(m.SubMaps) {
+				subMap := m.SubMaps[i]
+				// ancestor names are copied, appending to a shared backing array would overwrite the names of siblings
+				subMap.AncestorNames = append(append([]string{}, m.AncestorNames...), m.Fields[i].Name)
+				next = append(next, subMap)
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+// allocateMapperColumns assigns columns to the fields of a single mapper
+func allocateMapperColumns(m *Mapper, columns map[string]column, all map[string]column) error {
+	if m.variants != nil {
+		return allocateVariantColumns(m, columns, all)
+	}
 	presentColumns := map[string]column{}
-	for cName, c := range columns {
-		if m.IsBasic {
-			candidates = getColumnNameCandidates("", m.AncestorNames)
-			if _, ok := candidates[cName]; ok {
-				presentColumns[cName] = column{
-					typ:         c.typ,
-					name:        cName,
-					columnIndex: c.columnIndex,
-				}
-				delete(columns, cName) // dealocate claimed column
+	if m.IsBasic && len(m.AncestorNames) == 0 {
+		c, err := m.claimRootColumn(columns)
+		if err != nil {
+			return err
+		}
+		presentColumns[c.name] = c
+	} else if m.IsBasic {
+		if c, ok := m.claimColumn("", columns); ok {
+			presentColumns[c.name] = c
+		}
+	} else {
+		for _, i := range sortedFieldIndexes(m.Fields) {
+			// can only allocate columns to basic fields
+			if !m.Fields[i].isLeaf() {
+				continue
 			}
-		} else {
-			for i, field := range m.Fields {
-				candidates = getColumnNameCandidates(field.Name, m.AncestorNames)
-				// can only allocate columns to basic fields
-				if isBasicType(field.Typ) {
-					if _, ok := candidates[cName]; ok {
-						presentColumns[cName] = column{
-							typ:         c.typ,
-							name:        cName,
-							columnIndex: c.columnIndex,
-							i:           i,
-						}
-						delete(columns, cName) // dealocate claimed column
-					}
-				}
+			if c, ok := m.claimColumn(m.Fields[i].Name, columns); ok {
+				c.i = i
+				presentColumns[c.name] = c
 			}
 		}
 	}
 	m.PresentColumns = presentColumns
+	if m.tree != nil {
+		if err := allocateTreeColumns(m); err != nil {
+			return err
+		}
+	}
+	if m.Crd == Dictionary && m.keyColumn != "" {
+		// the key column may also be claimed by a field of the struct
+		if c, ok := presentColumns[m.keyColumn]; ok {
+			m.keyColumnIndex = c.columnIndex
+		} else if c, ok := columns[m.keyColumn]; ok {
+			m.keyColumnIndex = c.columnIndex
+			delete(columns, m.keyColumn)
+		} else {
+			return fmt.Errorf("carta: key column %s of map %s not found", m.keyColumn, m.path)
+		}
+	}
 
 	columnIds := []int{}
+	keyColumnIds := []int{}
 	for _, column := range m.PresentColumns {
 		if _, ok := m.SubMaps[column.i]; ok {
 			continue
 		}
 		columnIds = append(columnIds, column.columnIndex)
+		if !m.IsBasic && m.Fields[column.i].IsKey {
+			keyColumnIds = append(keyColumnIds, column.columnIndex)
+		}
+	}
+	if len(keyColumnIds) != 0 {
+		// identity of the struct is declared, other columns do not determine unique elements
+		if err := checkKeyColumns(m); err != nil {
+			return err
+		}
+		columnIds = keyColumnIds
+	}
+	if m.keyByColumn != "" {
+		// elements of basic collections keyed by a column are identified by that column alone,
+		// the column is usually a sibling, which a field of the parent may have claimed already
+		c, ok := all[m.keyByColumn]
+		if !ok {
+			return fmt.Errorf("carta: key column %s of %s not found", m.keyByColumn, m.path)
+		}
+		delete(columns, c.name)
+		columnIds = []int{c.columnIndex}
+	}
+	if m.Crd == Dictionary && m.keyColumn != "" && !containsInt(columnIds, m.keyColumnIndex) {
+		// elements with distinct keys are distinct
+		columnIds = append(columnIds, m.keyColumnIndex)
 	}
 	sort.Ints(columnIds)
 	m.SortedColumnIndexes = columnIds
+	return nil
+}
 
-	ancestorNames := []string{}
-	if len(m.AncestorNames) != 0 {
-		ancestorNames = m.AncestorNames
+// claimColumn removes the best match of the field from the pool and returns it,
+// which is the column matching the most specific candidate, ie "writer_author_id" rather than "author_id",
+// ties are broken by the position of columns. Other matching columns are left for other fields
+func (m *Mapper) claimColumn(fieldName string, columns map[string]column) (column, bool) {
+	best, found := m.bestColumn(fieldName, columns)
+	if !found {
+		return column{}, false
 	}
+	delete(columns, best.name) // dealocate claimed column
+	return best, true
+}
 
-	for i, subMap := range m.SubMaps {
-		subMap.AncestorNames = append(ancestorNames, m.Fields[i].Name)
-		if err := allocateColumns(subMap, columns); err != nil {
-			return err
+// claimRootColumn claims the column of a basic root, ie *[]int64, which is either named with WithColumn, or the only column of the rows
+func (m *Mapper) claimRootColumn(columns map[string]column) (column, error) {
+	if m.column != "" {
+		c, ok := columns[m.column]
+		if !ok {
+			return column{}, fmt.Errorf("carta: column %s of %s not found", m.column, m.path)
+		}
+		delete(columns, c.name)
+		return c, nil
+	}
+	if len(columns) != 1 {
+		return column{}, fmt.Errorf("carta: %s is loaded from a single column, found %d columns, name the column with carta.WithColumn", m.path, len(columns))
+	}
+	var c column
+	for _, c = range columns {
+	}
+	delete(columns, c.name)
+	return c, nil
+}
+
+// bestColumn returns the column of the pool which best matches the field, see claimColumn
+func (m *Mapper) bestColumn(fieldName string, columns map[string]column) (column, bool) {
+	var (
+		best     column
+		bestRank = -1
+	)
+	ranks := m.candidateRanks(fieldName)
+	for _, c := range m.matchingColumns(fieldName, columns) {
+		if rank := ranks[m.naming.NormalizeColumn(c.name)]; rank > bestRank {
+			best, bestRank = c, rank
 		}
 	}
+	return best, bestRank != -1
+}
+
+// matchingColumns returns columns of the pool matching the field, ordered by their position
+func (m *Mapper) matchingColumns(fieldName string, columns map[string]column) []column {
+	ranks := m.candidateRanks(fieldName)
+	matching := []column{}
+	for name, c := range columns {
+		if _, ok := ranks[m.naming.NormalizeColumn(name)]; ok {
+			matching = append(matching, c)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].columnIndex < matching[j].columnIndex })
+	return matching
+}
+
+// candidateRanks maps candidate column names of the field to their specificity, later candidates of the naming strategy are more specific
+func (m *Mapper) candidateRanks(fieldName string) map[string]int {
+	ranks := map[string]int{}
+	for rank, name := range m.naming.ColumnNames(fieldName, m.AncestorNames) {
+		ranks[name] = rank
+	}
+	return ranks
+}
+
+// checkStrict applies the checks of the strict mode once columns are allocated, columns are the remaining pool
+// the error lists every unmapped column and every unfilled field
+func checkStrict(m *Mapper, columns map[string]column, mode StrictMode) error {
+	problems := []string{}
+	if mode&StrictColumns != 0 {
+		if unmapped := unmappedColumns(columns); len(unmapped) != 0 {
+			problems = append(problems, fmt.Sprintf("columns %s are not mapped onto any field of %s", strings.Join(unmapped, ", "), m.path))
+		}
+	}
+	if mode&StrictFields != 0 {
+		if unfilled := unfilledFields(m); len(unfilled) != 0 {
+			problems = append(problems, fmt.Sprintf("fields %s have no column", strings.Join(unfilled, ", ")))
+		}
+	}
+	if len(problems) != 0 {
+		return errors.New("carta: " + strings.Join(problems, "; "))
+	}
 	return nil
 }
 
-func getColumnNameCandidates(fieldName string, ancestorNames []string) map[string]bool {
-	// empty field name means that the mapper is basic, since there is no struct assiciated with this slice, there is no field name
-	candidates := map[string]bool{}
-	if fieldName != "" {
-		candidates[fieldName] = true
-		candidates[toSnakeCase(fieldName)] = true
-		candidates[strings.ToLower(fieldName)] = true
-	}
-	if len(ancestorNames) == 0 {
-		return candidates
-	}
-	nameConcat := fieldName
-	for i := len(ancestorNames) - 1; i >= 0; i-- {
-		if nameConcat == "" {
-			nameConcat = ancestorNames[i]
-		} else {
-			nameConcat = ancestorNames[i] + "_" + nameConcat
+// unmappedColumns returns the names of columns which were not claimed by any field, ordered by position
+func unmappedColumns(columns map[string]column) []string {
+	unmapped := make([]column, 0, len(columns))
+	for _, c := range columns {
+		unmapped = append(unmapped, c)
+	}
+	sort.Slice(unmapped, func(i, j int) bool { return unmapped[i].columnIndex < unmapped[j].columnIndex })
+	names := make([]string, len(unmapped))
+	for i, c := range unmapped {
+		names[i] = c.name
+	}
+	return names
+}
+
+// unfilledFields returns the paths of fields of the mapper tree which have no column
+func unfilledFields(root *Mapper) []string {
+	unfilled := []string{}
+	var walk func(m *Mapper)
+	walk = func(m *Mapper) {
+		for _, discriminator := range m.sortedVariants() {
+			walk(m.variants[discriminator])
+		}
+		if m.IsBasic {
+			if len(m.PresentColumns) == 0 {
+				unfilled = append(unfilled, m.path)
+			}
+			return
+		}
+		filled := map[fieldIndex]bool{}
+		for _, c := range m.PresentColumns {
+			filled[c.i] = true
+		}
+		for _, i := range sortedFieldIndexes(m.Fields) {
+			if field := m.Fields[i]; field.isLeaf() && !field.Optional && !filled[i] {
+				unfilled = append(unfilled, m.fieldPath(i))
+			}
+		}
+		for _, i := range sortedSubMapIndexes(m.SubMaps) {
+			walk(m.SubMaps[i])
+		}
+	}
+	walk(root)
+	return unfilled
+}
+
+// claimant is a field which best matches a column, variants are the choices of polymorphic mappers on the path to the field
+type claimant struct {
+	path     string
+	variants map[*Mapper]string
+}
+
+// checkAmbiguousColumns returns an error listing every field which could claim a column, if a column is the best match of more than one field,
+// fields of distinct variants of a polymorphic mapper do not compete, since only one of them is loaded from a row
+func checkAmbiguousColumns(root *Mapper, columns map[string]column) error {
+	claimants := map[string][]claimant{}
+	var walk func(m *Mapper, variants map[*Mapper]string)
+	walk = func(m *Mapper, variants map[*Mapper]string) {
+		claim := func(fieldName string, path string) {
+			if c, ok := m.bestColumn(fieldName, columns); ok {
+				claimants[c.name] = append(claimants[c.name], claimant{path: path, variants: variants})
+			}
 		}
-		candidates[nameConcat] = true
-		candidates[strings.ToLower(nameConcat)] = true
-		candidates[toSnakeCase(nameConcat)] = true
+		if m.variants != nil {
+			claim(m.discriminator, m.path+" discriminator")
+			for _, discriminator := range m.sortedVariants() {
+				variant := m.variants[discriminator]
+				variant.AncestorNames = append([]string{}, m.AncestorNames...)
+				choices := map[*Mapper]string{m: discriminator}
+				for p, d := range variants {
+					choices[p] = d
+				}
+				walk(variant, choices)
+			}
+			return
+		}
+		if m.IsBasic {
+			claim("", m.path)
+			return
+		}
+		for _, i := range sortedFieldIndexes(m.Fields) {
+			if m.Fields[i].isLeaf() {
+				claim(m.Fields[i].Name, m.fieldPath(i))
+			}
+		}
+		for _, i := range sortedSubMapIndexes(m.SubMaps) {
+			subMap := m.SubMaps[i]
+			subMap.AncestorNames = append(append([]string{}, m.AncestorNames...), m.Fields[i].Name)
+			walk(subMap, variants)
+		}
+	}
+	walk(root, nil)
+
+	names := make([]string, 0, len(claimants))
+	for name := range claimants {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return columns[names[i]].columnIndex < columns[names[j]].columnIndex })
+	for _, name := range names {
+		if !competing(claimants[name]) {
+			continue
+		}
+		paths := []string{}
+		for _, c := range claimants[name] {
+			paths = append(paths, c.path)
+		}
+		return fmt.Errorf("carta: column %s is ambiguous, it can be claimed by %s", name, strings.Join(paths, ", "))
+	}
+	return nil
+}
+
+// competing tests whether any two claimants could be loaded from the same row
+func competing(claimants []claimant) bool {
+	for i := 0; i < len(claimants); i++ {
+		for j := i + 1; j < len(claimants); j++ {
+			exclusive := false
+			for p, d := range claimants[i].variants {
+				if other, ok := claimants[j].variants[p]; ok && other != d {
+					exclusive = true
+				}
+			}
+			if !exclusive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedSubMapIndexes(subMaps map[fieldIndex]*Mapper) []fieldIndex {
+	indexes := make([]fieldIndex, 0, len(subMaps))
+	for i := range subMaps {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(a, b int) bool { return indexes[a] < indexes[b] })
+	return indexes
+}
+
+// all key fields must be present, otherwise distinct elements sharing a partial key would be merged
+func checkKeyColumns(m *Mapper) error {
+	claimed := map[fieldIndex]bool{}
+	for _, column := range m.PresentColumns {
+		claimed[column.i] = true
+	}
+	for i, field := range m.Fields {
+		if field.IsKey && !claimed[i] {
+			return fmt.Errorf("carta: key field %s of %s has no column", field.Name, m.Typ)
+		}
+	}
+	return nil
+}
+
+func containsInt(ints []int, n int) bool {
+	for _, i := range ints {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// columnNameCandidates returns the normalized column names which map onto a field, see NamingStrategy
+func (m *Mapper) columnNameCandidates(fieldName string, ancestorNames []string) map[string]bool {
+	candidates := map[string]bool{}
+	for _, name := range m.naming.ColumnNames(fieldName, ancestorNames) {
+		candidates[name] = true
 	}
 	return candidates
 }
@@ -0,0 +1,58 @@
+package carta
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackskj/carta/value"
+)
+
+// Converter converts a cell into a value of the type it was registered for
+// cells can be null, see value.Cell.IsNull
+type Converter func(cell *value.Cell) (interface{}, error)
+
+var converters sync.Map // reflect.Type to Converter
+
+// RegisterConverter registers a function which converts cells into values of typ.
+// Fields of typ, or a pointer to typ, are then treated as basic and set with the converted value,
+// converters take priority over carta's own conversions, as well as sql.Scanner.
+//
+// Converters of value fields are called for null cells as well, pointer fields are left nil when a cell is null.
+// The converted value must be assignable or convertible to typ.
+//
+// Mappers are cached, therefore converters should be registered before mapping, ie in init
+func RegisterConverter(typ reflect.Type, fn func(cell *value.Cell) (interface{}, error)) {
+	converters.Store(typ, Converter(fn))
+}
+
+func converterFor(typ reflect.Type) (Converter, bool) {
+	if fn, ok := converters.Load(typ); ok {
+		return fn.(Converter), true
+	}
+	return nil, false
+}
+
+func hasConverter(typ reflect.Type) bool {
+	_, ok := converters.Load(typ)
+	return ok
+}
+
+func convert(dst reflect.Value, typ reflect.Type, cell *value.Cell, fn Converter) error {
+	d, err := fn(cell)
+	if err != nil {
+		return value.ConvertsionError(err, typ)
+	}
+	v := reflect.ValueOf(d)
+	switch {
+	case !v.IsValid():
+		// nil, destination is left as zero value
+	case v.Type().AssignableTo(typ):
+		dst.Set(v)
+	case v.Type().ConvertibleTo(typ):
+		dst.Set(v.Convert(typ))
+	default:
+		return fmt.Errorf("carta: converter of %s returned value of type %s", typ, v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package carta
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jackskj/carta/value"
+)
+
+// Has-many relationships can be mapped onto maps of structs, map[K]V or map[K]*V, keyed either by a field of the struct
+// tagged with the "mapkey" option, or by a column named with the "mapkey=column" option of the map field
+// type User struct {
+// 	UserId   int                `db:"user_id"`
+// 	Settings map[string]Setting `db:"settings"`
+// 	Logins   map[int]*Login     `db:"logins,mapkey=login_seq"`
+// }
+// type Setting struct {
+// 	Name  string `db:"setting_name,mapkey"`
+// 	Value string `db:"setting_value"`
+// }
+// Elements are resolved the same way as elements of slices, a key column takes part in the identity of elements.
+// Rows where every column of the element is null, ie from outer joins, are skipped.
+// Elements with a null key but other non-null columns are not added to the map, their key field must then be a pointer.
+// Distinct elements sharing a key are an error, since one of them would be silently dropped.
+
+// determineMapKey finds the field holding the map keys of a dictionary mapper, unless keys are loaded from a column
+func determineMapKey(m *Mapper) error {
+	keyFields := []fieldIndex{}
+	for _, i := range sortedFieldIndexes(m.Fields) {
+		if m.Fields[i].IsMapKey {
+			keyFields = append(keyFields, i)
+		}
+	}
+	if m.keyColumn != "" {
+		if len(keyFields) != 0 {
+			return fmt.Errorf("carta: map %s has both a key column and a key field", m.path)
+		}
+		if !isBasicType(m.KeyTyp) {
+			return fmt.Errorf("carta: key type %s of map %s cannot be loaded from a column", m.KeyTyp, m.path)
+		}
+		return nil
+	}
+	if len(keyFields) == 0 {
+		return fmt.Errorf("carta: map %s has no key, tag a field of %s with the \"mapkey\" option or name the key column with \"mapkey=column\"", m.path, m.Typ)
+	}
+	if len(keyFields) > 1 {
+		return fmt.Errorf("carta: map %s has multiple key fields", m.path)
+	}
+	field := m.Fields[keyFields[0]]
+	typ := field.Typ
+	if field.IsPtr {
+		typ = field.ElemTyp
+	}
+	if !(typ.AssignableTo(m.KeyTyp) || typ.ConvertibleTo(m.KeyTyp) && keyKind(typ.Kind()) == keyKind(m.KeyTyp.Kind())) {
+		return fmt.Errorf("carta: key field %s of type %s cannot be used as a key of map %s", m.fieldPath(keyFields[0]), typ, m.path)
+	}
+	m.keyField = keyFields[0]
+	return nil
+}
+
+// keyKind groups kinds of key fields which convert to each other without changing the key,
+// unlike conversions between kinds of different groups, ie an int converts to a string holding a rune
+func keyKind(kind reflect.Kind) reflect.Kind {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	}
+	return kind
+}
+
+// mapKey returns the key of elem in the parent map, keyCell is the cell of the key column, if keys are loaded from a column
+// the returned value is invalid if the key is null
+func (m *Mapper) mapKey(elem reflect.Value, keyCell *value.Cell) (reflect.Value, error) {
+	if m.keyColumn != "" {
+		if keyCell == nil || keyCell.IsNull() {
+			return reflect.Value{}, nil
+		}
+		key := reflect.New(m.KeyTyp).Elem()
+		if err := setValue(key, m.KeyTyp.Kind(), m.KeyTyp, keyCell); err != nil {
+			return reflect.Value{}, fmt.Errorf("carta: cannot load key column %s of map %s: %w", m.keyColumn, m.path, err)
+		}
+		return key, nil
+	}
+	key := m.field(elem, m.keyField)
+	if key.Kind() == reflect.Ptr {
+		if key.IsNil() {
+			return reflect.Value{}, nil
+		}
+		key = key.Elem()
+	}
+	return key.Convert(m.KeyTyp), nil
+}
+
+// setMapIndex adds an element to a map, distinct elements sharing a key are an error
+func setMapIndex(m *Mapper, dst reflect.Value, key reflect.Value, v reflect.Value) error {
+	if !key.IsValid() {
+		// null key
+		return nil
+	}
+	if dst.MapIndex(key).IsValid() {
+		return fmt.Errorf("carta: duplicate key %v in map %s", key, m.path)
+	}
+	dst.SetMapIndex(key, v)
+	return nil
+}
@@ -0,0 +1,118 @@
+package carta
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Anonymous embedded structs are flattened, their fields are mapped as if they were declared on the outer struct,
+// the same way Go promotes fields of embedded structs
+// type Employee struct {
+// 	Id   int
+// 	Name string
+// }
+// type Manager struct {
+// 	Employee              // id and name columns are mapped onto Manager.Id and Manager.Name
+// 	Reports  []Employee
+// }
+// A shallower field shadows promoted fields of the same name, and fields of the same name promoted from the same depth
+// are ambiguous and not mapped, as in Go.
+// Embedded structs with a name in the db tag, ie `db:"employee"`, are not flattened and are mapped as has-one relationships.
+
+// structFields returns the exported fields of the struct type t, including fields promoted from flattened embedded structs,
+// the Index of each returned field is the index sequence from t, fields are ordered as they are declared
+func structFields(t reflect.Type) []reflect.StructField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var (
+		fields  []reflect.StructField
+		seen    = map[string]bool{} // names found at shallower depths
+		visited = map[reflect.Type]bool{t: true}
+		current = []embedded{{typ: t}}
+	)
+	for len(current) > 0 {
+		var (
+			next       []embedded
+			candidates []reflect.StructField
+			count      = map[string]int{}
+		)
+		for _, e := range current {
+			for i := 0; i < e.typ.NumField(); i++ {
+				field := e.typ.Field(i)
+				field.Index = append(append([]int{}, e.index...), i)
+				count[field.Name]++
+				candidates = append(candidates, field)
+			}
+		}
+		for _, field := range candidates {
+			if seen[field.Name] || count[field.Name] > 1 {
+				// shadowed or ambiguous
+				continue
+			}
+			if isFlattened(field) {
+				typ := field.Type
+				if typ.Kind() == reflect.Ptr {
+					typ = typ.Elem()
+				}
+				if !visited[typ] {
+					visited[typ] = true
+					next = append(next, embedded{typ: typ, index: field.Index})
+				}
+				continue
+			}
+			if isExported(field) {
+				fields = append(fields, field)
+			}
+		}
+		for name := range count {
+			seen[name] = true
+		}
+		current = next
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].Index, fields[j].Index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+// isFlattened tests whether the field is an embedded struct whose fields are promoted
+func isFlattened(field reflect.StructField) bool {
+	if !field.Anonymous {
+		return false
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		if !isExported(field) {
+			// nil pointers to unexported structs cannot be allocated
+			return false
+		}
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || isBasicType(typ) {
+		return false
+	}
+	name, opts := parseTag(field.Tag)
+	return name == "" && !isLeafTag(opts)
+}
+
+// fieldByIndex returns the nested field of v with the index sequence, allocating nil embedded pointers on the way
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,69 @@
+package carta
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrTooManyRows is returned by MapOne when the rows resolve to more than one root object,
+// and by Map when rows have more than one distinct value for a single basic destination, ie *time.Time
+var ErrTooManyRows = errors.New("carta: more than one object was found")
+
+// MapAll maps rows onto a new slice of T, where T is a struct, a pointer to a struct or a basic type
+//
+//	blogs, err := carta.MapAll[Blog](rows)
+func MapAll[T any](rows *sql.Rows, opts ...Option) ([]T, error) {
+	return MapAllSource[T](SQLRows(rows), opts...)
+}
+
+// MapAllSource is like MapAll, but reads rows from any RowSource, ie pgx rows adapted with PgxRows
+func MapAllSource[T any](src RowSource, opts ...Option) ([]T, error) {
+	dst := []T{}
+	if err := MapSource(src, &dst, opts...); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// MapOne maps rows onto exactly one T,
+// it returns sql.ErrNoRows if no object was found and ErrTooManyRows if rows resolve to more than one object.
+// Note that multiple rows can resolve to one object, ie a blog with many posts
+func MapOne[T any](rows *sql.Rows, opts ...Option) (T, error) {
+	return MapOneSource[T](SQLRows(rows), opts...)
+}
+
+// MapOneSource is like MapOne, but reads rows from any RowSource, ie pgx rows adapted with PgxRows
+func MapOneSource[T any](src RowSource, opts ...Option) (T, error) {
+	var zero T
+	dst, err := MapAllSource[T](src, opts...)
+	if err != nil {
+		return zero, err
+	}
+	switch len(dst) {
+	case 0:
+		return zero, sql.ErrNoRows
+	case 1:
+		return dst[0], nil
+	default:
+		return zero, ErrTooManyRows
+	}
+}
+
+// MapFirst maps rows onto the first T that was found,
+// it returns sql.ErrNoRows if no object was found
+func MapFirst[T any](rows *sql.Rows, opts ...Option) (T, error) {
+	return MapFirstSource[T](SQLRows(rows), opts...)
+}
+
+// MapFirstSource is like MapFirst, but reads rows from any RowSource, ie pgx rows adapted with PgxRows
+func MapFirstSource[T any](src RowSource, opts ...Option) (T, error) {
+	var zero T
+	dst, err := MapAllSource[T](src, opts...)
+	if err != nil {
+		return zero, err
+	}
+	if len(dst) == 0 {
+		return zero, sql.ErrNoRows
+	}
+	return dst[0], nil
+}
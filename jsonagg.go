@@ -0,0 +1,230 @@
+package carta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/jackskj/carta/value"
+)
+
+// Has-one and has-many relationships marked with the "jsonagg" tag option are loaded from a single json column,
+// such as json_agg(json_build_object(...)) in postgres or JSON_ARRAYAGG(JSON_OBJECT(...)) in mysql.
+// This avoids multiplying rows when joining many has-many relationships.
+//
+// Keys of json objects are matched with struct fields using the same rules as column names, without ancestor prefixes,
+// nested structs, slices and maps are loaded from nested json objects and arrays,
+// basic fields are converted the same way as columns are.
+
+// loadJSONAgg decodes a json column onto dst, which is a field of the type m was created for
+func loadJSONAgg(m *Mapper, cell *value.Cell, dst reflect.Value) error {
+	d, err := cell.Bytes()
+	if err != nil {
+		return err
+	}
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(d))
+	decoder.UseNumber()
+	if err = decoder.Decode(&raw); err != nil {
+		return err
+	}
+	return loadJSON(m, raw, dst)
+}
+
+func loadJSON(m *Mapper, raw interface{}, dst reflect.Value) error {
+	if text, ok := raw.(string); ok && !m.IsBasic {
+		// nested json which was aggregated as text
+		return loadJSONAgg(m, jsonCell(text), dst)
+	}
+	if raw == nil {
+		return nil
+	}
+	if m.Crd == Collection {
+		items, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected json array for %s, got %T", m.path, raw)
+		}
+		elemTyp := m.Typ
+		if m.IsTypePtr {
+			elemTyp = reflect.PtrTo(m.Typ)
+		}
+		list := reflect.MakeSlice(reflect.SliceOf(elemTyp), 0, len(items))
+		for _, item := range items {
+			if item == nil && !m.IsBasic {
+				// outer joins aggregate to [null]
+				continue
+			}
+			elem, err := newJSONElem(m, item)
+			if err != nil {
+				return err
+			}
+			if elem.IsValid() {
+				list = reflect.Append(list, elem)
+			}
+		}
+		if m.IsListPtr {
+			listPtr := reflect.New(list.Type())
+			listPtr.Elem().Set(list)
+			dst.Set(listPtr)
+		} else {
+			dst.Set(list)
+		}
+		return nil
+	}
+
+	if m.Crd == Dictionary {
+		items, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected json array for %s, got %T", m.path, raw)
+		}
+		elemTyp := m.Typ
+		if m.IsTypePtr {
+			elemTyp = reflect.PtrTo(m.Typ)
+		}
+		dict := reflect.MakeMapWithSize(reflect.MapOf(m.KeyTyp, elemTyp), len(items))
+		for _, item := range items {
+			if item == nil {
+				continue
+			}
+			elem := reflect.New(m.Typ).Elem()
+			if err := loadJSONElem(m, item, elem); err != nil {
+				return err
+			}
+			var keyCell *value.Cell
+			if obj, ok := item.(map[string]interface{}); ok && m.keyColumn != "" {
+				keyCell = jsonCell(obj[m.keyColumn])
+			}
+			key, err := m.mapKey(elem, keyCell)
+			if err != nil {
+				return err
+			}
+			v := elem
+			if m.IsTypePtr {
+				v = elem.Addr()
+			}
+			if err = setMapIndex(m, dict, key, v); err != nil {
+				return err
+			}
+		}
+		dst.Set(dict)
+		return nil
+	}
+
+	// has-one relationship, an aggregated array holds at most one object
+	if items, ok := raw.([]interface{}); ok {
+		if len(items) == 0 || items[0] == nil {
+			return nil
+		}
+		raw = items[0]
+	}
+	elem, err := newJSONElem(m, raw)
+	if err != nil {
+		return err
+	}
+	if elem.IsValid() {
+		dst.Set(elem)
+	}
+	return nil
+}
+
+// newJSONElem loads a json value onto a new element of m, which is a pointer if the elements of m are pointed to
+// elements of polymorphic mappers are loaded by the variant named by the discriminator key of the json object,
+// the returned value is invalid if the discriminator is null
+func newJSONElem(m *Mapper, raw interface{}) (reflect.Value, error) {
+	if m.variants != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected json object for %s, got %T", m.path, raw)
+		}
+		variant, err := m.variantFor(jsonCell(obj[m.discriminator]))
+		if variant == nil || err != nil {
+			return reflect.Value{}, err
+		}
+		return newJSONElem(variant, raw)
+	}
+	if m.IsBasic && m.IsTypePtr && raw == nil {
+		return reflect.Zero(reflect.PtrTo(m.Typ)), nil
+	}
+	elem := reflect.New(m.Typ).Elem()
+	if err := loadJSONElem(m, raw, elem); err != nil {
+		return reflect.Value{}, err
+	}
+	if m.IsTypePtr {
+		return elem.Addr(), nil
+	}
+	return elem, nil
+}
+
+// loadJSONElem loads a single json value onto elem, a new instance of m.Typ
+func loadJSONElem(m *Mapper, raw interface{}, elem reflect.Value) error {
+	if m.IsBasic {
+		return setField(m, 0, elem, jsonCell(raw), m.path)
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected json object for %s, got %T", m.path, raw)
+	}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, i := range sortedFieldIndexes(m.Fields) {
+		field := m.Fields[i]
+		candidates := m.columnNameCandidates(field.Name, nil)
+		for _, key := range keys {
+			if !candidates[m.naming.NormalizeColumn(key)] {
+				continue
+			}
+			var err error
+			if subMap, ok := m.SubMaps[i]; ok {
+				err = loadJSON(subMap, obj[key], m.field(elem, i))
+			} else if field.IsJSONAgg && field.aggMapper != nil {
+				err = loadJSON(field.aggMapper, obj[key], m.field(elem, i))
+			} else if field.isLeaf() {
+				err = setField(m, i, elem, jsonCell(obj[key]), key)
+			}
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// jsonCell converts a decoded json value into a cell, nested objects and arrays are kept as json text
+func jsonCell(v interface{}) *value.Cell {
+	cell := value.NewCell("")
+	switch d := v.(type) {
+	case nil:
+		cell.SetNull()
+	case bool:
+		cell.SetBool(d)
+	case json.Number:
+		if i, err := d.Int64(); err == nil {
+			cell.SetInt64(i)
+		} else {
+			f, _ := d.Float64()
+			cell.SetFloat64(f)
+		}
+	case string:
+		cell.SetString(d)
+	default:
+		b, _ := json.Marshal(d)
+		cell.SetBytes(b)
+	}
+	return cell
+}
+
+func sortedFieldIndexes(fields map[fieldIndex]Field) []fieldIndex {
+	indexes := make([]fieldIndex, 0, len(fields))
+	for i := range fields {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(a, b int) bool { return indexes[a] < indexes[b] })
+	return indexes
+}
@@ -1,35 +1,57 @@
 package carta
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 
 	"github.com/jackskj/carta/value"
 )
 
-func (m *Mapper) loadRows(rows *sql.Rows, colTyps []*sql.ColumnType) (*resolver, error) {
-	defer rows.Close() // may not need
-	var err error
-	row := make([]interface{}, len(colTyps))
-	colTypNames := make([]string, len(colTyps))
-	for i := 0; i < len(colTyps); i++ {
-		colTypNames[i] = colTyps[i].DatabaseTypeName()
-	}
+func (m *Mapper) loadRows(ctx context.Context, src RowSource, colTypNames []string, opts *options) (*resolver, error) {
 	rsv := newResolver()
-	for rows.Next() {
-		for i := 0; i < len(colTyps); i++ {
-			row[i] = value.NewCell(colTypNames[i])
+	rowCount, err := scanRows(ctx, src, colTypNames, opts, func(row []interface{}) error {
+		return loadRow(m, row, rsv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsv.rowCount = rowCount
+	return rsv, nil
+}
+
+// scanRows scans every row of the current result set into cells and passes them to load,
+// rows are not closed, since further result sets may follow, returns the number of rows that were loaded
+func scanRows(ctx context.Context, src RowSource, colTypNames []string, opts *options, load func(row []interface{}) error) (int, error) {
+	var err error
+	rowCount := 0
+	row := make([]interface{}, len(colTypNames))
+	for src.Next() {
+		if ctx.Err() != nil {
+			return rowCount, cancelled(ctx, rowCount)
+		}
+		for i := 0; i < len(colTypNames); i++ {
+			row[i] = value.NewCellWithTimeParser(colTypNames[i], opts.timeParser)
 		}
-		if err = rows.Scan(row...); err != nil {
-			return nil, err
+		if err = src.Scan(row...); err != nil {
+			return rowCount, err
 		}
-		if err = loadRow(m, row, rsv); err != nil {
-			return nil, err
+		if err = load(row); err != nil {
+			return rowCount, err
 		}
+		rowCount++
 	}
-	return rsv, nil
+	if err = src.Err(); err != nil {
+		if ctx.Err() != nil {
+			return rowCount, cancelled(ctx, rowCount)
+		}
+		return rowCount, err
+	}
+	return rowCount, nil
 }
 
 // load row maps a single sql row onto a structure that resembles the users struct
@@ -38,163 +60,85 @@ func (m *Mapper) loadRows(rows *sql.Rows, colTyps []*sql.ColumnType) (*resolver,
 // if new object is foind, create a new instance of a struct that
 // maps onto that struct,
 // for example, if a user maps onto:
-// type Blog struct {
-//          BlogId string
-// }
+//
+//	type Blog struct {
+//	         BlogId string
+//	}
+//
 // blogs := []Blog:
 // carta.Map(rows, &blogs)
 // if a new blog_id column value is found, I instantiatiate a new instance of Blog,
 // set BlogId, then store the pointer referenct to this instance in the resolver
 // nothins is done when the object has been already mapped in previous rows, however,
 // the function contunous to recursivelly map rows for all sub mappings inside Blog
-//  for example, if a blog has many Authors
+//
+//	for example, if a blog has many Authors
+//
 // rows are actually []*Cell, theu are passed here as interface since sql scan requires []interface{}
 func loadRow(m *Mapper, row []interface{}, rsv *resolver) error {
 	var (
-		err      error
-		dstField reflect.Value // destination field to be set with
-		cell     *value.Cell
-		elem     *element
-		found    bool
+		err   error
+		cell  *value.Cell
+		elem  *element
+		found bool
 	)
 
-	uid := getUniqueId(row, m)
+	uid, variant, err := elementUid(m, row)
+	if err != nil {
+		return err
+	}
+	if variant == nil {
+		// null discriminator, no element
+		return nil
+	}
+	if variant.recursive && nullColumns(row, variant.SortedColumnIndexes) {
+		// the nested level of a recursive struct is null below the leaves of the tree
+		return nil
+	}
+	if m.valuePtr && nullColumns(row, m.SortedColumnIndexes) {
+		// the pointer of a basic root is left nil
+		return nil
+	}
+	if m.Crd == Dictionary && nullColumns(row, variant.SortedColumnIndexes) {
+		// no element of the map, ie from an outer join, keys are not loaded, therefore key fields need not be pointers
+		return nil
+	}
+	if m.keyByRow {
+		// every row is a new element, regardless of its values
+		uid = uniqueValId(strconv.Itoa(len(rsv.elementOrder)))
+	}
+	polymorphic := variant != m
+	// the variant mapper loads the concrete type of polymorphic elements
+	m = variant
 
 	if elem, found = rsv.elements[uid]; !found {
 		// unique row mapping found, new object
 		loadElem := reflect.New(m.Typ).Elem()
 
 		for _, col := range m.PresentColumns {
-			var (
-				kind     reflect.Kind  // kind of destination
-				dst      reflect.Value // destination to set
-				typ      reflect.Type  // underlying type of the destination
-				isDstPtr bool          //is the destination a pointer
-			)
-
 			cell = row[col.columnIndex].(*value.Cell)
-
-			if m.IsBasic {
-				dst = loadElem
-				kind = m.Kind
-				typ = m.Typ
-				isDstPtr = m.IsTypePtr
-			} else {
-				dstField = loadElem.Field(int(col.i))
-				if m.Fields[col.i].IsPtr {
-					dst = reflect.New(m.Fields[col.i].ElemTyp).Elem()
-					kind = m.Fields[col.i].ElemKind
-					typ = m.Fields[col.i].ElemTyp
-					isDstPtr = true
-				} else {
-					dst = dstField
-					kind = m.Fields[col.i].Kind
-					typ = m.Fields[col.i].Typ
-					isDstPtr = false
-				}
-			}
-			if cell.IsNull() {
-				_, nullable := value.NullableTypes[typ]
-				if !(isDstPtr || nullable) {
-					return errors.New(fmt.Sprintf("carta: cannot load null value to type %s for column %s", typ, col.name))
-				}
-				// no need to set destination if cell is null
-			} else {
-				switch kind {
-				case reflect.Bool:
-					if d, err := cell.Bool(); err != nil {
-						return value.ConvertsionError(err, typ)
-					} else {
-						dst.SetBool(d)
-					}
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-					if d, err := cell.Uint64(); err != nil {
-						return value.ConvertsionError(err, typ)
-					} else {
-						dst.SetUint(d)
-					}
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					if d, err := cell.Int64(); err != nil {
-						return value.ConvertsionError(err, typ)
-					} else {
-						dst.SetInt(d)
-					}
-				case reflect.String:
-					if d, err := cell.String(); err != nil {
-						return value.ConvertsionError(err, typ)
-					} else {
-						dst.SetString(d)
-					}
-				case reflect.Float32, reflect.Float64:
-					if d, err := cell.Float64(); err != nil {
-						return value.ConvertsionError(err, typ)
-					} else {
-						dst.SetFloat(d)
-					}
-				case reflect.Struct:
-					if strTyp, ok := value.BasicTypes[typ]; ok {
-						// TODO: Type asserion, prevent from calling ValueOf
-						// TODO: make these stupid error checks more concise
-						//  this swich statement should be optimized
-
-						switch strTyp {
-						case value.Time:
-							if d, err := cell.Time(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.Timestamp:
-							if d, err := cell.Timestamp(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.NullBool:
-							if d, err := cell.NullBool(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.NullFloat64:
-							if d, err := cell.NullFloat64(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.NullInt32:
-							if d, err := cell.NullInt32(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.NullInt64:
-							if d, err := cell.NullInt64(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.NullString:
-							if d, err := cell.NullString(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						case value.NullTime:
-							if d, err := cell.NullTime(); err != nil {
-								return value.ConvertsionError(err, typ)
-							} else {
-								dst.Set(reflect.ValueOf(d))
-							}
-						}
-					}
-				}
-				if !m.IsBasic && m.Fields[col.i].IsPtr {
-					dstField.Set(dst.Addr())
-				}
+			if err = setField(m, col.i, loadElem, cell, col.name); err != nil {
+				return err
 			}
 		}
 		elem = &element{v: loadElem}
+		if polymorphic {
+			elem.variant = m
+		}
+		if m.tree != nil {
+			if elem.treeKey, elem.treeParent, err = m.treeKeys(loadElem); err != nil {
+				return err
+			}
+		}
+		if m.Crd == Dictionary {
+			var keyCell *value.Cell
+			if m.keyColumnIndex != -1 {
+				keyCell = row[m.keyColumnIndex].(*value.Cell)
+			}
+			if elem.key, err = m.mapKey(loadElem, keyCell); err != nil {
+				return err
+			}
+		}
 		if len(m.SubMaps) != 0 {
 			elem.subMaps = map[fieldIndex]*resolver{}
 			for i, _ := range m.SubMaps {
@@ -214,12 +158,301 @@ func loadRow(m *Mapper, row []interface{}, rsv *resolver) error {
 	return nil
 }
 
+// setField sets the ith field of elem with the value of a cell, if the mapper is basic, elem itself is set
+// column is the name of the column the cell originates from, used in errors
+func setField(m *Mapper, i fieldIndex, elem reflect.Value, cell *value.Cell, column string) error {
+	var (
+		dstField reflect.Value // destination field to be set with
+		kind     reflect.Kind  // kind of destination
+		dst      reflect.Value // destination to set
+		typ      reflect.Type  // underlying type of the destination
+		isDstPtr bool          //is the destination a pointer
+	)
+
+	if m.IsBasic {
+		dst = elem
+		kind = m.Kind
+		typ = m.Typ
+		isDstPtr = m.IsTypePtr
+	} else {
+		dstField = m.field(elem, i)
+		if m.Fields[i].IsPtr {
+			dst = reflect.New(m.Fields[i].ElemTyp).Elem()
+			kind = m.Fields[i].ElemKind
+			typ = m.Fields[i].ElemTyp
+			isDstPtr = true
+		} else {
+			dst = dstField
+			kind = m.Fields[i].Kind
+			typ = m.Fields[i].Typ
+			isDstPtr = false
+		}
+	}
+	if !m.IsBasic && m.Fields[i].IsJSON {
+		if cell.IsNull() {
+			// json null, destination is left as zero value
+			return nil
+		}
+		if err := setJSON(dst, cell); err != nil {
+			return fmt.Errorf("carta: cannot decode json column %s into %s: %w", column, m.fieldPath(i), err)
+		}
+		if m.Fields[i].IsPtr {
+			dstField.Set(dst.Addr())
+		}
+	} else if !m.IsBasic && m.Fields[i].IsJSONAgg {
+		if cell.IsNull() || m.Fields[i].aggMapper == nil {
+			// no related objects
+			return nil
+		}
+		if err := loadJSONAgg(m.Fields[i].aggMapper, cell, dstField); err != nil {
+			return fmt.Errorf("carta: cannot load json column %s into %s: %w", column, m.fieldPath(i), err)
+		}
+	} else if !m.IsBasic && m.Fields[i].IsArray {
+		if cell.IsNull() {
+			// null array, destination is left as nil slice
+			return nil
+		}
+		if err := setArray(dst, cell); err != nil {
+			return fmt.Errorf("carta: cannot load array column %s into %s: %w", column, m.fieldPath(i), err)
+		}
+		if m.Fields[i].IsPtr {
+			dstField.Set(dst.Addr())
+		}
+	} else if cell.IsNull() && (isDstPtr || !(isScanner(typ) || hasConverter(typ))) {
+		_, nullable := value.NullableTypes[typ]
+		nullable = nullable || typ.Kind() == reflect.Slice // nil []byte
+		if !(isDstPtr || nullable) {
+			return errors.New(fmt.Sprintf("carta: cannot load null value to type %s for column %s", typ, column))
+		}
+		// no need to set destination if cell is null
+	} else {
+		if err := setValue(dst, kind, typ, cell); err != nil {
+			return err
+		}
+		if !m.IsBasic && m.Fields[i].IsPtr {
+			dstField.Set(dst.Addr())
+		}
+	}
+	return nil
+}
+
+// setValue sets dst, which is of a basic type, with the value of a cell
+// the cell can only be null if typ has a registered converter or is a Scanner
+// Scanners are set with the value that arrived from the sql driver
+func setValue(dst reflect.Value, kind reflect.Kind, typ reflect.Type, cell *value.Cell) error {
+	if fn, ok := converterFor(typ); ok {
+		return convert(dst, typ, cell, fn)
+	}
+	if _, ok := value.BasicTypes[typ]; !ok && isScanner(typ) {
+		v, err := cell.Value()
+		if err != nil {
+			return value.ConvertsionError(err, typ)
+		}
+		if err = dst.Addr().Interface().(sql.Scanner).Scan(v); err != nil {
+			return value.ConvertsionError(err, typ)
+		}
+		return nil
+	}
+	switch kind {
+	case reflect.Bool:
+		if d, err := cell.Bool(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else {
+			dst.SetBool(d)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if d, err := cell.Uint64(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else {
+			dst.SetUint(d)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if d, err := cell.Int64(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else {
+			dst.SetInt(d)
+		}
+	case reflect.String:
+		if d, err := cell.String(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else {
+			dst.SetString(d)
+		}
+	case reflect.Float32, reflect.Float64:
+		if d, err := cell.Float64(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else {
+			dst.SetFloat(d)
+		}
+	case reflect.Slice:
+		if d, err := cell.Bytes(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else {
+			dst.SetBytes(d)
+		}
+	case reflect.Array:
+		if d, err := cell.Bytes(); err != nil {
+			return value.ConvertsionError(err, typ)
+		} else if len(d) != dst.Len() {
+			return fmt.Errorf("carta: cannot load %d bytes to type %s", len(d), typ)
+		} else {
+			for i, b := range d {
+				dst.Index(i).SetUint(uint64(b))
+			}
+		}
+	case reflect.Struct:
+		if strTyp, ok := value.BasicTypes[typ]; ok {
+			// TODO: Type asserion, prevent from calling ValueOf
+			// TODO: make these stupid error checks more concise
+			//  this swich statement should be optimized
+
+			switch strTyp {
+			case value.Time:
+				if d, err := cell.Time(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			case value.Timestamp:
+				if d, err := cell.TimestampProto(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d).Elem())
+				}
+			case value.NullBool:
+				if d, err := cell.NullBool(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			case value.NullFloat64:
+				if d, err := cell.NullFloat64(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			case value.NullInt32:
+				if d, err := cell.NullInt32(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			case value.NullInt64:
+				if d, err := cell.NullInt64(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			case value.NullString:
+				if d, err := cell.NullString(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			case value.NullTime:
+				if d, err := cell.NullTime(); err != nil {
+					return value.ConvertsionError(err, typ)
+				} else {
+					dst.Set(reflect.ValueOf(d))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// setJSON decodes a json column into dst, which can be of any type
+func setJSON(dst reflect.Value, cell *value.Cell) error {
+	d, err := cell.Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(d, dst.Addr().Interface())
+}
+
+// setArray parses a postgres array literal into dst, a slice of basic types, nested slices take nested dimensions
+// elements are converted the same way as columns are, using the type name of the array column without the leading underscore
+func setArray(dst reflect.Value, cell *value.Cell) error {
+	text, err := cell.String()
+	if err != nil {
+		return err
+	}
+	elems, err := value.ParseArray(text)
+	if err != nil {
+		return err
+	}
+	return setArrayElems(dst, elems, value.ArrayElemTypeName(cell.TypeName()), cell.TimeParser())
+}
+
+func setArrayElems(dst reflect.Value, elems []interface{}, elemTypName string, timeParser *value.TimeParser) error {
+	list := reflect.MakeSlice(dst.Type(), len(elems), len(elems))
+	for i, e := range elems {
+		if nested, ok := e.([]interface{}); ok {
+			if isBasicType(list.Type().Elem()) {
+				return fmt.Errorf("array has more dimensions than %s", dst.Type())
+			}
+			if err := setArrayElems(list.Index(i), nested, elemTypName, timeParser); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isBasicType(list.Type().Elem()) {
+			return fmt.Errorf("array has fewer dimensions than %s", dst.Type())
+		}
+		cell := value.NewCellWithTimeParser(elemTypName, timeParser)
+		if e == nil {
+			cell.SetNull()
+		} else {
+			cell.SetString(e.(string))
+		}
+		if err := setArrayElem(list.Index(i), cell); err != nil {
+			return err
+		}
+	}
+	dst.Set(list)
+	return nil
+}
+
+// setArrayElem sets a single element of an array, which may be a pointer
+func setArrayElem(dst reflect.Value, cell *value.Cell) error {
+	typ := dst.Type()
+	isDstPtr := typ.Kind() == reflect.Ptr
+	if isDstPtr {
+		typ = typ.Elem()
+	}
+	if cell.IsNull() && (isDstPtr || !(isScanner(typ) || hasConverter(typ))) {
+		if _, nullable := value.NullableTypes[typ]; !(isDstPtr || nullable) {
+			return fmt.Errorf("cannot load null element to type %s", typ)
+		}
+		return nil
+	}
+	if !isDstPtr {
+		return setValue(dst, typ.Kind(), typ, cell)
+	}
+	elem := reflect.New(typ).Elem()
+	if err := setValue(elem, typ.Kind(), typ, cell); err != nil {
+		return err
+	}
+	dst.Set(elem.Addr())
+	return nil
+}
+
+// nullColumns returns whether all columns of the row at indexes are null
+func nullColumns(row []interface{}, indexes []int) bool {
+	for _, i := range indexes {
+		if !row[i].(*value.Cell).IsNull() {
+			return false
+		}
+	}
+	return true
+}
+
 // Generates unique id based on the ancestors of the struct as well as currently considered colum values
+// the id is a concatenation of self delimiting cell encodings, see value.Cell.Uid
 func getUniqueId(row []interface{}, m *Mapper) uniqueValId {
-	// TODO: set capacity of the uid slice, using bytes.buffer
-	uid := ""
+	uid := make([]byte, 0, 16*len(m.SortedColumnIndexes))
 	for _, i := range m.SortedColumnIndexes {
-		uid = uid + row[i].(*value.Cell).Uid()
+		uid = row[i].(*value.Cell).AppendUid(uid)
 	}
 	return uniqueValId(uid)
 }
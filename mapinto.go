@@ -0,0 +1,281 @@
+package carta
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackskj/carta/value"
+)
+
+// MapInto maps rows onto a has-one or has-many relationship of parents which were already mapped, ie by a previous query,
+// this avoids multiplying rows of parents by joining every relationship in one query
+//
+//	err := carta.Map(blogRows, &blogs)
+//	err = carta.MapInto(postRows, &blogs, "Posts")
+//
+// parents must be a pointer to a slice of structs, or of pointers to structs, or a pointer to a struct,
+// and field the name of the relationship in the parent struct.
+// Rows are matched with parents by the key fields of the parent, declared with the "pk" tag option,
+// which are loaded from the columns of the rows named as in the parent, ie "blog_id".
+// Elements are appended to slices and added to maps already held by parents, a has-one relationship is set
+// if a row of its parent is found. Rows without a parent are skipped.
+func MapInto(rows *sql.Rows, parents interface{}, field string, opts ...Option) error {
+	return MapIntoContext(context.Background(), rows, parents, field, opts...)
+}
+
+// MapIntoContext is like MapInto, but stops mapping once ctx is done, see MapContext
+func MapIntoContext(ctx context.Context, rows *sql.Rows, parents interface{}, field string, opts ...Option) error {
+	return MapIntoSourceContext(ctx, SQLRows(rows), parents, field, opts...)
+}
+
+// MapIntoSource is like MapInto, but reads rows from any RowSource, ie pgx rows adapted with PgxRows
+func MapIntoSource(src RowSource, parents interface{}, field string, opts ...Option) error {
+	return MapIntoSourceContext(context.Background(), src, parents, field, opts...)
+}
+
+// MapIntoSourceContext is like MapIntoSource, but stops mapping once ctx is done, see MapContext
+func MapIntoSourceContext(ctx context.Context, src RowSource, parents interface{}, field string, opts ...Option) error {
+	defer src.Close()
+	columns, err := src.Columns()
+	if err != nil {
+		return err
+	}
+	colTypNames, err := src.ColumnTypeNames()
+	if err != nil {
+		return err
+	}
+	o := newOptions(opts)
+	into, err := intoMapperFor(columns, colTypNames, reflect.TypeOf(parents), field, o)
+	if err != nil {
+		return err
+	}
+
+	// elements of every parent are resolved separately, parents are identified by their keys
+	resolvers := map[interface{}]*resolver{}
+	rowCount, err := scanRows(ctx, src, colTypNames, o, func(row []interface{}) error {
+		key, ok, err := into.rowKey(row)
+		if !ok || err != nil {
+			return err
+		}
+		rsv, ok := resolvers[key]
+		if !ok {
+			rsv = newResolver()
+			resolvers[key] = rsv
+		}
+		return loadRow(into.child, row, rsv)
+	})
+	if err != nil {
+		return err
+	}
+
+	dst := reflect.Indirect(reflect.ValueOf(parents))
+	if dst.Kind() == reflect.Struct {
+		err = into.setParent(ctx, dst, resolvers)
+	} else {
+		for i := 0; i < dst.Len() && err == nil; i++ {
+			parent := dst.Index(i)
+			if parent.Kind() == reflect.Ptr {
+				if parent.IsNil() {
+					continue
+				}
+				parent = parent.Elem()
+			}
+			err = into.setParent(ctx, parent, resolvers)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return cancelled(ctx, rowCount)
+	}
+	return err
+}
+
+// intoMapper maps rows onto the relationship of parents
+type intoMapper struct {
+	parent     *Mapper // mapper of the parent struct, used to load and compare keys
+	child      *Mapper // mapper of the relationship, allocated as the root of the rows
+	field      fieldIndex
+	keyFields  []fieldIndex
+	keyColumns []column
+	keyTyp     reflect.Type // array holding a value of every key field, used as a key of maps
+}
+
+var intoCache sync.Map
+
+// intoMapperFor loads the mapper of the relationship of parents from the cache, or generates a new one
+func intoMapperFor(columns []string, colTypNames []string, parentsTyp reflect.Type, field string, opts *options) (*intoMapper, error) {
+	entry := mapperEntry{columns, parentsTyp, opts.key() + "|" + field}
+	if into, ok := intoCache.Load(entry.raw()); ok {
+		return into.(*intoMapper), nil
+	}
+	if !(isSlicePtr(parentsTyp) || isStructPtr(parentsTyp)) {
+		return nil, fmt.Errorf("carta: cannot map rows into %s, parents must be pointer to a slice(*[]) or pointer to a struct", parentsTyp)
+	}
+	parent, err := newMapper(parentsTyp, nil, opts.maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	if parent.IsBasic || parent.Kind != reflect.Struct || parent.variants != nil {
+		return nil, fmt.Errorf("carta: cannot map rows into %s, parents must be structs", parentsTyp)
+	}
+	parent.naming = opts.naming
+	if err = determineFieldsNames(parent); err != nil {
+		return nil, err
+	}
+
+	into := &intoMapper{parent: parent, field: -1}
+	for i, f := range parent.structFields {
+		if f.Name == field {
+			into.field = fieldIndex(i)
+		}
+	}
+	if into.field == -1 {
+		return nil, fmt.Errorf("carta: field %s not found in %s", field, parent.Typ)
+	}
+	if into.child = parent.SubMaps[into.field]; into.child == nil {
+		return nil, fmt.Errorf("carta: field %s is not a has-one or has-many relationship", parent.fieldPath(into.field))
+	}
+
+	columnsByName := map[string]column{}
+	for i, columnName := range columns {
+		columnsByName[columnName] = column{
+			name:        columnName,
+			typ:         colTypNames[i],
+			columnIndex: i,
+		}
+	}
+	// key columns are found before allocation, since fields of the child, ie Post.BlogId, may also claim them
+	for _, i := range sortedFieldIndexes(parent.Fields) {
+		if !parent.Fields[i].IsKey {
+			continue
+		}
+		if !isComparableKey(parent.Fields[i].Typ) {
+			return nil, fmt.Errorf("carta: key field %s of type %s cannot be compared", parent.fieldPath(i), parent.Fields[i].Typ)
+		}
+		c, ok := parent.bestColumn(parent.Fields[i].Name, columnsByName)
+		if !ok {
+			return nil, fmt.Errorf("carta: key column %s of %s not found", parent.Fields[i].Name, parent.fieldPath(i))
+		}
+		c.i = i
+		into.keyFields = append(into.keyFields, i)
+		into.keyColumns = append(into.keyColumns, c)
+	}
+	if len(into.keyFields) == 0 {
+		return nil, fmt.Errorf("carta: %s has no key fields to match rows with, declare them with the pk tag option", parent.Typ)
+	}
+	into.keyTyp = reflect.ArrayOf(len(into.keyFields), reflect.TypeOf((*interface{})(nil)).Elem())
+
+	// the relationship is the root of the rows, its columns are not prefixed with the name of the field
+	child := into.child
+	if child.IsBasic {
+		// basic elements, ie Tags []string, take the only column besides key columns
+		for _, c := range into.keyColumns {
+			delete(columnsByName, c.name)
+		}
+		child.column = opts.column
+		child.keyByRow = opts.keepDuplicates
+	}
+	if opts.ambiguityErrors {
+		if err = checkAmbiguousColumns(child, columnsByName); err != nil {
+			return nil, err
+		}
+	}
+	if err = allocateColumns(child, columnsByName); err != nil {
+		return nil, err
+	}
+	pruneRecursiveMappers(child)
+	for _, c := range into.keyColumns {
+		delete(columnsByName, c.name)
+	}
+	if err = checkStrict(child, columnsByName, opts.strict); err != nil {
+		return nil, err
+	}
+
+	intoCache.Store(entry.raw(), into)
+	return into, nil
+}
+
+// rowKey loads the key of the parent of a row, ok is false if any key column is null
+func (into *intoMapper) rowKey(row []interface{}) (key interface{}, ok bool, err error) {
+	// key columns are loaded onto a parent, therefore their values are converted to the types of the parent key fields
+	parent := reflect.New(into.parent.Typ).Elem()
+	for _, c := range into.keyColumns {
+		cell := row[c.columnIndex].(*value.Cell)
+		if cell.IsNull() {
+			return nil, false, nil
+		}
+		if err = setField(into.parent, c.i, parent, cell, c.name); err != nil {
+			return nil, false, err
+		}
+	}
+	key, err = into.parentKey(parent)
+	return key, err == nil, err
+}
+
+// parentKey returns the values of the key fields of a parent as an array, which can be compared with the keys of other parents
+func (into *intoMapper) parentKey(parent reflect.Value) (interface{}, error) {
+	key := reflect.New(into.keyTyp).Elem()
+	for j, i := range into.keyFields {
+		v, err := keyValue(into.parent.field(parent, i))
+		if err != nil {
+			return nil, fmt.Errorf("carta: cannot compare key field %s: %w", into.parent.fieldPath(i), err)
+		}
+		if v != nil {
+			key.Index(j).Set(reflect.ValueOf(v))
+		}
+	}
+	return key.Interface(), nil
+}
+
+// setParent adds the elements resolved for the parent to its relationship
+func (into *intoMapper) setParent(ctx context.Context, parent reflect.Value, resolvers map[interface{}]*resolver) error {
+	key, err := into.parentKey(parent)
+	if err != nil {
+		return err
+	}
+	rsv, ok := resolvers[key]
+	if !ok {
+		rsv = newResolver()
+	}
+	field := into.parent.field(parent, into.field)
+	if into.child.Crd == Association && len(rsv.elementOrder) == 0 {
+		// has-one relationship of a parent without rows is left as it is
+		return nil
+	}
+	// elements are set onto a new value of the field first, then added to the relationship held by the parent
+	loaded := reflect.New(field.Type()).Elem()
+	if err := setSubMap(ctx, into.child, loaded, rsv); err != nil {
+		return err
+	}
+	switch into.child.Crd {
+	case Collection:
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field.Set(loaded)
+				return nil
+			}
+			field, loaded = field.Elem(), loaded.Elem()
+		}
+		if field.IsNil() {
+			field.Set(loaded)
+		} else {
+			field.Set(reflect.AppendSlice(field, loaded))
+		}
+	case Dictionary:
+		if field.IsNil() {
+			field.Set(loaded)
+			return nil
+		}
+		iter := loaded.MapRange()
+		for iter.Next() {
+			if err := setMapIndex(into.child, field, iter.Key(), iter.Value()); err != nil {
+				return err
+			}
+		}
+	default:
+		field.Set(loaded)
+	}
+	return nil
+}
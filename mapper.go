@@ -1,6 +1,7 @@
 package carta
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -16,12 +17,14 @@ const (
 // SQL Map cardinality can either be:
 // Association: has-one relationship, must be nested structs in the response
 // Collection: had-many relationship, repeated (slice, array) nested struct or pointer to it
+// Dictionary: has-many relationship, map of nested structs or pointers to them, keyed by a field of the struct or by a column
 type Cardinality int
 
 const (
 	Unknown Cardinality = iota
 	Association
 	Collection
+	Dictionary
 )
 
 type Field struct {
@@ -34,6 +37,20 @@ type Field struct {
 	IsPtr    bool
 	ElemTyp  reflect.Type // if Typ is *int, elemTyp is int
 	ElemKind reflect.Kind // if kind is ptr and typ is *int, elem kind is int
+
+	IsKey     bool // field is a part of the identity of its struct, set with the "pk" tag option
+	IsJSON    bool // column is decoded as json, set with the "json" tag option
+	IsJSONAgg bool // relationship is loaded from an aggregated json column, set with the "jsonagg" tag option
+	IsArray   bool // slice is parsed from a postgres array column, set with the "array" tag option
+	IsMapKey  bool // field holds the key of the struct in a parent map, set with the "mapkey" tag option
+	Optional  bool // field may have no column in strict mode, set with the "optional" tag option
+
+	aggMapper *Mapper // mapper of the field type, used to load aggregated json
+}
+
+// leaf fields are loaded from a single column
+func (f Field) isLeaf() bool {
+	return f.IsJSON || f.IsJSONAgg || f.IsArray || isBasicType(f.Typ)
 }
 
 type Mapper struct {
@@ -50,7 +67,7 @@ type Mapper struct {
 	//        UserStuff *[]*string       // also basic mapper
 	//        UserBlog  []*Blog          // this is NOT a basic mapper
 	// }
-	// basic can only be true if cardinality is collection
+	// basic can only be true if cardinality is collection, or for roots which are pointers to a basic type, ie *time.Time
 	IsBasic bool
 
 	Typ  reflect.Type // Underlying type to be mapped
@@ -58,10 +75,13 @@ type Mapper struct {
 
 	IsTypePtr bool // is the underlying type pointed to
 
+	KeyTyp reflect.Type // type of map keys, used only if cardinality is a dictionary
+
 	// present columns are columns that were found to map onto a particular fild of a struct.
 	// those fiels must either be basic (primative, time or sql.NullXX)
 	PresentColumns map[string]column
-	// Sorted columns are present columns in consistant order,
+	// Sorted columns are present columns in consistant order, they are used to generate unique ids
+	// if the struct declares key fields, only columns of key fields are included
 	SortedColumnIndexes []int
 
 	// when reusing the same struct multiple times, you are able to specify the colimn prefix using parent structs
@@ -82,67 +102,163 @@ type Mapper struct {
 	// Nested structs which correspond to any has-one has-many relationships
 	// int is the ith element of this struct where the submap exists
 	SubMaps map[fieldIndex]*Mapper
+
+	path string // path of go fields from the root type, ie Blog.Posts, used in errors
+
+	// fields of the struct, including fields promoted from embedded structs, fieldIndex is the position in this slice
+	structFields []reflect.StructField
+
+	// map keys are either loaded from the key field of the struct, or from the key column,
+	// which is named with the "mapkey=column" option of the map field, used only if cardinality is a dictionary
+	keyField       fieldIndex
+	keyColumn      string
+	keyColumnIndex int
+
+	// mappers of concrete types of a polymorphic interface mapper, keyed by the discriminator value, see RegisterVariant
+	variants      map[string]*Mapper
+	discriminator string // name of the discriminator column
+
+	naming NamingStrategy // matches columns with fields, see WithNamingStrategy
+
+	types     []reflect.Type // struct types of the mapper and its ancestors, used to detect recursive types
+	maxDepth  int            // times a recursive type can be nested in itself, see WithMaxDepth
+	recursive bool           // the type of the mapper is also the type of an ancestor
+
+	tree *tree // fields of a struct loaded as a tree from an adjacency list, nil for other structs
+
+	column   string // column of a basic root, see WithColumn
+	valuePtr bool   // basic root is a pointer to a pointer, ie *(*time.Time), which is set to a new value unless rows are null
+	keyByRow bool   // elements are keyed by the position of their row rather than by their columns, see KeepDuplicates
+
+	keyByColumn string // elements of a basic collection are keyed by the column named with the "keyby=column" tag option
 }
 
 // Maps db rows onto the complex struct,
 // Response must be a struct, pointer to a struct for our response, a slice of structs or slice of pointers to a struct
-func Map(rows *sql.Rows, dst interface{}) error {
+// options, ie WithNamingStrategy, configure the mapping
+func Map(rows *sql.Rows, dst interface{}, opts ...Option) error {
+	return MapContext(context.Background(), rows, dst, opts...)
+}
+
+// MapContext is like Map, but stops mapping once ctx is done.
+// The context is checked between rows and while setting the destination,
+// on cancellation rows are closed and ctx.Err() is returned, wrapped with the number of rows mapped so far
+func MapContext(ctx context.Context, rows *sql.Rows, dst interface{}, opts ...Option) error {
+	return MapSourceContext(ctx, SQLRows(rows), dst, opts...)
+}
+
+// MapSource is like Map, but reads rows from any RowSource, ie pgx rows adapted with PgxRows
+func MapSource(src RowSource, dst interface{}, opts ...Option) error {
+	return MapSourceContext(context.Background(), src, dst, opts...)
+}
+
+// MapSourceContext is like MapSource, but stops mapping once ctx is done, see MapContext
+func MapSourceContext(ctx context.Context, src RowSource, dst interface{}, opts ...Option) error {
+	defer src.Close()
+	return mapResultSet(ctx, src, dst, newOptions(opts))
+}
+
+// mapResultSet maps the current result set of src onto dst, src is not closed
+func mapResultSet(ctx context.Context, src RowSource, dst interface{}, opts *options) error {
 	var (
 		mapper *Mapper
 		err    error
 		rsv    *resolver
 	)
-	columns, err := rows.Columns()
+	columns, err := src.Columns()
 	if err != nil {
 		return err
 	}
-	columnTypes, err := rows.ColumnTypes()
+	colTypNames, err := src.ColumnTypeNames()
 	if err != nil {
 		return err
 	}
-	dstTyp := reflect.TypeOf(dst)
-	mapper, ok := mapperCache.loadMap(columns, dstTyp)
-	if !ok {
-		if !(isSlicePtr(dstTyp) || isStructPtr(dstTyp)) {
-			return fmt.Errorf("carta: cannot map rows onto %s, destination must be pointer to a slice(*[]) or pointer to a struct", dstTyp)
-		}
+	if mapper, err = mapperFor(columns, colTypNames, reflect.TypeOf(dst), opts); err != nil {
+		return err
+	}
 
-		// generate new mapper
-		if mapper, err = newMapper(dstTyp); err != nil {
-			return err
-		}
+	if rsv, err = mapper.loadRows(ctx, src, colTypNames, opts); err != nil {
+		return err
+	}
+	if mapper.IsBasic && mapper.Crd == Association && len(rsv.elementOrder) > 1 {
+		// a single basic value, ie *time.Time, cannot hold distinct values of several rows
+		return fmt.Errorf("%w, %s holds a single value, but rows have %d distinct values", ErrTooManyRows, mapper.Typ, len(rsv.elementOrder))
+	}
 
-		// determine field names
-		if err = determineFieldsNames(mapper); err != nil {
-			return err
+	if err = setDst(ctx, mapper, reflect.ValueOf(dst), rsv); err != nil {
+		if ctx.Err() != nil {
+			return cancelled(ctx, rsv.rowCount)
 		}
+		return err
+	}
+	return nil
+}
 
-		// Allocate columns
-		columnsByName := map[string]column{}
-		for i, columnName := range columns {
-			columnsByName[columnName] = column{
-				name:        columnName,
-				typ:         columnTypes[i],
-				columnIndex: i,
-			}
-		}
-		if err = allocateColumns(mapper, columnsByName); err != nil {
-			return err
-		}
+// mapperFor loads the mapper for the columns and destination type from the cache, or generates a new one
+func mapperFor(columns []string, colTypNames []string, dstTyp reflect.Type, opts *options) (*Mapper, error) {
+	var (
+		mapper *Mapper
+		err    error
+	)
+	mapper, ok := mapperCache.loadMap(columns, dstTyp, opts)
+	if ok {
+		return mapper, nil
+	}
+	if !(isSlicePtr(dstTyp) || isStructPtr(dstTyp) || isBasicPtr(dstTyp)) {
+		return nil, fmt.Errorf("carta: cannot map rows onto %s, destination must be pointer to a slice(*[]), pointer to a struct or pointer to a basic type", dstTyp)
+	}
 
-		mapperCache.storeMap(columns, dstTyp, mapper)
+	// generate new mapper
+	if mapper, err = newMapper(dstTyp, nil, opts.maxDepth); err != nil {
+		return nil, err
+	}
 
+	// determine field names
+	mapper.naming = opts.naming
+	if mapper.IsBasic {
+		mapper.column = opts.column
+		mapper.keyByRow = opts.keepDuplicates
+	}
+	if err = determineFieldsNames(mapper); err != nil {
+		return nil, err
 	}
 
-	if rsv, err = mapper.loadRows(rows, columnTypes); err != nil {
-		return err
+	// Allocate columns
+	columnsByName := map[string]column{}
+	for i, columnName := range columns {
+		columnsByName[columnName] = column{
+			name:        columnName,
+			typ:         colTypNames[i],
+			columnIndex: i,
+		}
+	}
+	if opts.ambiguityErrors {
+		if err = checkAmbiguousColumns(mapper, columnsByName); err != nil {
+			return nil, err
+		}
+	}
+	if err = allocateColumns(mapper, columnsByName); err != nil {
+		return nil, err
+	}
+	pruneRecursiveMappers(mapper)
+	if err = checkStrict(mapper, columnsByName, opts.strict); err != nil {
+		return nil, err
 	}
 
-	return setDst(mapper, reflect.ValueOf(dst), rsv)
+	mapperCache.storeMap(columns, dstTyp, opts, mapper)
+	return mapper, nil
+}
 
+func cancelled(ctx context.Context, rowCount int) error {
+	return fmt.Errorf("carta: mapping cancelled after %d rows: %w", rowCount, ctx.Err())
 }
 
-func newMapper(t reflect.Type) (*Mapper, error) {
+// errDepthLimit is returned by newMapper when a recursive type is nested deeper than the depth limit,
+// the field is then left out of the mapping
+var errDepthLimit = errors.New("carta: depth limit of recursive type reached")
+
+// newMapper generates a mapper for t, ancestors are the struct types of the mappers t is nested in, outermost first
+func newMapper(t reflect.Type, ancestors []reflect.Type, maxDepth int) (*Mapper, error) {
 	var (
 		crd     Cardinality
 		elemTyp reflect.Type
@@ -154,8 +270,19 @@ func newMapper(t reflect.Type) (*Mapper, error) {
 	isListPtr := false
 	isBasic := false
 	isTypePtr := false
+	valuePtr := false
 
-	if isSlicePtr(t) {
+	if isBasicPtr(t) {
+		// single basic value, ie *time.Time, only roots are pointers to basic types
+		crd = Association
+		elemTyp = t.Elem()
+		isBasic = true
+		isTypePtr = true
+		if elemTyp.Kind() == reflect.Ptr {
+			elemTyp = elemTyp.Elem()
+			valuePtr = true
+		}
+	} else if isSlicePtr(t) {
 		crd = Collection
 		elemTyp = t.Elem().Elem() // *[]interface{} to intetrface{}
 		isListPtr = true
@@ -163,6 +290,17 @@ func newMapper(t reflect.Type) (*Mapper, error) {
 		crd = Association
 		crd = Collection
 		elemTyp = t.Elem() // []interface{} to intetrface{}
+	} else if isStructMap(t) {
+		crd = Dictionary
+		elemTyp = t.Elem() // map[string]interface{} to interface{}
+	} else if isPolymorphic(t) {
+		crd = Association
+		elemTyp = t
+	}
+
+	if crd == Dictionary && elemTyp.Kind() == reflect.Ptr {
+		elemTyp = elemTyp.Elem()
+		isTypePtr = true
 	}
 
 	if crd == Collection {
@@ -173,7 +311,7 @@ func newMapper(t reflect.Type) (*Mapper, error) {
 		}
 	}
 
-	if isStructPtr(t) {
+	if isStructPtr(t) && !isBasicPtr(t) {
 		crd = Association
 		elemTyp = t.Elem()
 		isTypePtr = true
@@ -186,6 +324,19 @@ func newMapper(t reflect.Type) (*Mapper, error) {
 		return nil, errors.New("carts: unknown mapping")
 	}
 
+	depth := 0
+	for _, ancestor := range ancestors {
+		if ancestor == elemTyp {
+			depth++
+		}
+	}
+	if depth > maxDepth {
+		if maxDepth == 0 {
+			return nil, fmt.Errorf("carta: %s is recursive, set the depth of recursive structs with carta.WithMaxDepth", elemTyp)
+		}
+		return nil, errDepthLimit
+	}
+
 	mapper = &Mapper{
 		Crd:       crd,
 		IsListPtr: isListPtr,
@@ -193,29 +344,95 @@ func newMapper(t reflect.Type) (*Mapper, error) {
 		Typ:       elemTyp,
 		Kind:      elemTyp.Kind(),
 		IsTypePtr: isTypePtr,
+		maxDepth:  maxDepth,
+		recursive: depth > 0,
+		valuePtr:  valuePtr,
+	}
+	mapper.types = append(append([]reflect.Type{}, ancestors...), elemTyp)
+	if crd == Dictionary {
+		mapper.KeyTyp = t.Key()
+		mapper.keyColumnIndex = -1
 	}
-	if subMaps, err = findSubMaps(mapper.Typ); err != nil {
+	if isPolymorphic(elemTyp) {
+		mapper.discriminator = defaultDiscriminator
+		if err = newVariantMappers(mapper); err != nil {
+			return nil, err
+		}
+	}
+	if mapper.Kind == reflect.Struct && !isBasic {
+		mapper.structFields = structFields(mapper.Typ)
+		if mapper.tree, err = findTree(mapper.Typ, mapper.structFields); err != nil {
+			return nil, err
+		}
+	}
+	if subMaps, err = findSubMaps(mapper, mapper.structFields); err != nil {
 		return nil, err
 	}
 	mapper.SubMaps = subMaps
 	return mapper, nil
 }
 
-func findSubMaps(t reflect.Type) (map[fieldIndex]*Mapper, error) {
+// pruneRecursiveMappers removes nested levels of recursive types which do not map onto any column,
+// it returns whether m, or any mapper nested in it, maps onto a column
+func pruneRecursiveMappers(m *Mapper) bool {
+	claims := len(m.PresentColumns) != 0
+	for _, i := range sortedSubMapIndexes(m.SubMaps) {
+		subMap := m.SubMaps[i]
+		if pruneRecursiveMappers(subMap) {
+			claims = true
+		} else if subMap.recursive {
+			delete(m.SubMaps, i)
+		}
+	}
+	for _, discriminator := range m.sortedVariants() {
+		if pruneRecursiveMappers(m.variants[discriminator]) {
+			claims = true
+		}
+	}
+	return claims
+}
+
+func findSubMaps(m *Mapper, fields []reflect.StructField) (map[fieldIndex]*Mapper, error) {
 	var (
 		subMap *Mapper
 		err    error
 	)
-	subMaps := map[fieldIndex]*Mapper{}
-	if t.Kind() != reflect.Struct {
+	if fields == nil {
 		return nil, nil
 	}
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
+	subMaps := map[fieldIndex]*Mapper{}
+	for i, field := range fields {
+		_, opts := parseTag(field.Tag)
+		if isLeafTag(opts) {
+			continue
+		}
+		if m.tree != nil && fieldIndex(i) == m.tree.children {
+			// children of trees are linked after loading, see linkTree
+			continue
+		}
 		if isExported(field) && isSubMap(field.Type) {
-			if subMap, err = newMapper(field.Type); err != nil {
+			if subMap, err = newMapper(field.Type, m.types, m.maxDepth); err == errDepthLimit {
+				// recursion ends, the field is left empty
+				continue
+			} else if err != nil {
 				return nil, err
 			}
+			subMap.keyColumn = opts.get(mapKeyOption)
+			if opts.has(keyByOption) {
+				if !subMap.IsBasic || subMap.Crd != Collection {
+					return nil, fmt.Errorf("carta: the keyby option of %s.%s requires a slice of a basic type", m.Typ, field.Name)
+				}
+				if keyBy := opts.get(keyByOption); keyBy == "row" {
+					subMap.keyByRow = true
+				} else if keyBy != "" {
+					subMap.keyByColumn = keyBy
+				} else {
+					return nil, fmt.Errorf("carta: the keyby option of %s.%s must be either row or the name of a column", m.Typ, field.Name)
+				}
+			}
+			if d := opts.get(discriminatorOption); d != "" {
+				subMap.discriminator = d
+			}
 			subMaps[fieldIndex(i)] = subMap
 		}
 	}
@@ -225,79 +442,176 @@ func findSubMaps(t reflect.Type) (map[fieldIndex]*Mapper, error) {
 func determineFieldsNames(m *Mapper) error {
 	var (
 		name string
+		err  error
 	)
 	fields := map[fieldIndex]Field{}
 
+	if m.path == "" {
+		m.path = m.Typ.String()
+	}
 	if m.IsBasic {
 		return nil
 	}
 
-	for i := 0; i < m.Typ.NumField(); i++ {
-		field := m.Typ.Field(i)
-		if isExported(field) {
-			if tag := nameFromTag(field.Tag); tag != "" {
-				name = tag
-			} else {
-				name = field.Name
-			}
-			f := Field{
-				Name:  name,
-				Typ:   field.Type,
-				Kind:  field.Type.Kind(),
-				IsPtr: (field.Type.Kind() == reflect.Ptr),
+	for i, field := range m.structFields {
+		tag, opts := parseTag(field.Tag)
+		if tag != "" {
+			name = tag
+		} else {
+			name = field.Name
+		}
+		f := Field{
+			Name:      name,
+			Typ:       field.Type,
+			Kind:      field.Type.Kind(),
+			IsPtr:     (field.Type.Kind() == reflect.Ptr),
+			IsKey:     opts.has(pkOption) || opts.has(treeKeyOption),
+			IsJSON:    opts.has(jsonOption),
+			IsJSONAgg: opts.has(jsonAggOption),
+			IsArray:   opts.has(arrayOption),
+			IsMapKey:  opts.has(mapKeyOption),
+			Optional:  opts.has(optionalOption),
+		}
+		if f.IsPtr {
+			f.ElemKind = field.Type.Elem().Kind()
+			f.ElemTyp = field.Type.Elem()
+		}
+		if f.IsArray && !isBasicArray(field.Type) {
+			return fmt.Errorf("carta: field %s with the array option must be a slice of a basic type, found %s", m.fieldPath(fieldIndex(i)), field.Type)
+		}
+		if f.IsJSONAgg {
+			if f.aggMapper, err = newMapper(field.Type, m.types, m.maxDepth); err == errDepthLimit {
+				// recursion ends, the field is left empty
+				f.aggMapper = nil
+				fields[fieldIndex(i)] = f
+				continue
+			} else if err != nil {
+				return err
 			}
-			if f.IsPtr {
-				f.ElemKind = field.Type.Elem().Kind()
-				f.ElemTyp = field.Type.Elem()
+			f.aggMapper.path = m.fieldPath(fieldIndex(i))
+			f.aggMapper.naming = m.naming
+			f.aggMapper.keyColumn = opts.get(mapKeyOption)
+			if err = determineFieldsNames(f.aggMapper); err != nil {
+				return err
 			}
-			fields[fieldIndex(i)] = f
 		}
+		fields[fieldIndex(i)] = f
 	}
 	m.Fields = fields
-	for _, subMap := range m.SubMaps {
+	if m.Crd == Dictionary {
+		if err = determineMapKey(m); err != nil {
+			return err
+		}
+	}
+	for i, subMap := range m.SubMaps {
+		subMap.path = m.fieldPath(i)
+		subMap.naming = m.naming
 		if err := determineFieldsNames(subMap); err != nil {
 			return err
 		}
 	}
+	for _, discriminator := range m.sortedVariants() {
+		variant := m.variants[discriminator]
+		variant.path = m.path + "[" + discriminator + "]"
+		variant.naming = m.naming
+		if err := determineFieldsNames(variant); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func isExported(f reflect.StructField) bool {
-	return (f.PkgPath == "")
+// path of the ith field, ie Blog.Posts.PostId
+func (m *Mapper) fieldPath(i fieldIndex) string {
+	return m.path + "." + m.structFields[i].Name
 }
 
-func nameFromTag(t reflect.StructTag) string {
-	return t.Get(CartaTagKey)
+// field returns the ith field of elem, an instance of the mapped struct
+func (m *Mapper) field(elem reflect.Value, i fieldIndex) reflect.Value {
+	return fieldByIndex(elem, m.structFields[i].Index)
+}
 
+func isExported(f reflect.StructField) bool {
+	return (f.PkgPath == "")
 }
 
 func isSubMap(t reflect.Type) bool {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
-	return (!isBasicType(t) && (t.Kind() == reflect.Struct || t.Kind() == reflect.Slice))
+	if t.Kind() == reflect.Slice && isPolymorphic(t.Elem()) {
+		return true
+	}
+	return (!isBasicType(t) && (t.Kind() == reflect.Struct || t.Kind() == reflect.Slice || isStructMap(t) || isPolymorphic(t)))
 }
 
 // Basic types are any types that are intended to be set from sql row data
-// Primative fields, sql.NullXXX, time.Time, proto timestamp qualify as basic
+// Primative fields, sql.NullXXX, time.Time, proto timestamp, []byte, any sql.Scanner and types with a registered converter qualify as basic
 func isBasicType(t reflect.Type) bool {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
+	if hasConverter(t) {
+		return true
+	}
 	if _, ok := value.BasicKinds[t.Kind()]; ok {
 		return true
 	}
 	if _, ok := value.BasicTypes[t]; ok {
 		return true
 	}
+	if value.IsBytes(t) {
+		return true
+	}
+	if isScanner(t) {
+		return true
+	}
 	return false
 }
 
+// test whether the type is a, possibly multidimensional, slice of basic types, or a pointer to one
+func isBasicArray(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	for t.Kind() == reflect.Slice && !isBasicType(t) {
+		t = t.Elem()
+	}
+	return isBasicType(t)
+}
+
+var scannerTyp = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// test whether the type, or a pointer to it, implements sql.Scanner
+func isScanner(t reflect.Type) bool {
+	return t.Implements(scannerTyp) || reflect.PtrTo(t).Implements(scannerTyp)
+}
+
 // test wether the type to be set is a pointer to a struct, courtesy of BQ api
 func isStructPtr(t reflect.Type) bool {
 	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
 }
 
+// test whether the type is a map of structs or pointers to structs
+func isStructMap(t reflect.Type) bool {
+	if t.Kind() != reflect.Map {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct && !isBasicType(elem)
+}
+
+// test whether the type is a pointer to a basic type, ie *int64, *time.Time or *sql.NullString
+func isBasicPtr(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr && isBasicType(t.Elem())
+}
+
 func isSlicePtr(t reflect.Type) bool {
 	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice
 }
@@ -10,12 +10,15 @@ import (
 	"log"
 	"net"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jackskj/carta"
 	td "github.com/jackskj/carta/testdata"
 	"github.com/jackskj/carta/testdata/initdb"
+	"github.com/jackskj/carta/value"
 	diff "github.com/yudai/gojsondiff"
 	"github.com/yudai/gojsondiff/formatter"
 	"google.golang.org/grpc"
@@ -297,3 +300,632 @@ func TestRelation(m *testing.T) {
 		testResults["TestRelation"] = resp
 	}
 }
+
+func TestMapContextCancelled(m *testing.T) {
+	for dbName, rows := range query(td.BlogQuery) {
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		resp := []td.Blog{}
+		if err := carta.MapContext(cancelledCtx, rows, &resp); !errors.Is(err, context.Canceled) {
+			log.Fatalf("%s: expected context.Canceled, got %v", dbName, err)
+		}
+	}
+}
+
+func TestStream(m *testing.T) {
+	for dbName, rows := range query(td.BlogQuery) {
+		resp := []td.Blog{}
+		if err := carta.Stream(rows, func(blog *td.Blog) error {
+			resp = append(resp, *blog)
+			return nil
+		}); err != nil {
+			log.Fatal(err.Error())
+		}
+		mapped := []td.Blog{}
+		if err := carta.Map(query(td.BlogQuery)[dbName], &mapped); err != nil {
+			log.Fatal(err.Error())
+		}
+		streamed, _ := json.Marshal(resp)
+		ans, _ := json.Marshal(mapped)
+		if string(streamed) != string(ans) {
+			log.Fatal(errors.New("Test Stream Produced Inconsistent Results"))
+		}
+	}
+}
+
+func TestMapSource(m *testing.T) {
+	for dbName, rows := range query(td.BlogQuery) {
+		resp := []td.Blog{}
+		if err := carta.MapSource(carta.SQLRows(rows), &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		mapped := []td.Blog{}
+		if err := carta.Map(query(td.BlogQuery)[dbName], &mapped); err != nil {
+			log.Fatal(err.Error())
+		}
+		fromSource, _ := json.Marshal(resp)
+		ans, _ := json.Marshal(mapped)
+		if string(fromSource) != string(ans) {
+			log.Fatal(errors.New("Test Map Source Produced Inconsistent Results"))
+		}
+	}
+}
+
+func TestPgxRows(m *testing.T) {
+	sources := map[string]func() (carta.RowSource, *td.PgxRows){
+		"v4": func() (carta.RowSource, *td.PgxRows) {
+			rows := &td.PgxRows{Values: td.NewPgxValues()}
+			fields := []td.PgxFieldV4{{Name: []byte("blog_id"), DataTypeOID: 20}, {Name: []byte("title"), DataTypeOID: 25}}
+			return carta.PgxRows(td.PgxRowsV4{PgxRows: rows, Fields: fields}), rows
+		},
+		"v5": func() (carta.RowSource, *td.PgxRows) {
+			rows := &td.PgxRows{Values: td.NewPgxValues()}
+			fields := []td.PgxFieldV5{{Name: "blog_id", DataTypeOID: 20}, {Name: "title", DataTypeOID: 25}}
+			return carta.PgxRows(td.PgxRowsV5{PgxRows: rows, Fields: fields}), rows
+		},
+	}
+	for version, source := range sources {
+		src, _ := source()
+		columns, err := src.Columns()
+		if err != nil || !reflect.DeepEqual(columns, []string{"blog_id", "title"}) {
+			log.Fatalf("%s: unexpected columns %v, %v", version, columns, err)
+		}
+		colTypNames, err := src.ColumnTypeNames()
+		if err != nil || !reflect.DeepEqual(colTypNames, []string{"INT8", "TEXT"}) {
+			log.Fatalf("%s: unexpected column types %v, %v", version, colTypNames, err)
+		}
+
+		src, rows := source()
+		blogs := []td.PgxBlog{}
+		if err := carta.MapSource(src, &blogs); err != nil {
+			log.Fatalf("%s: %s", version, err)
+		}
+		if !reflect.DeepEqual(blogs, []td.PgxBlog{{BlogId: 1, Title: "first"}, {BlogId: 2, Title: "second"}}) || !rows.Closed {
+			log.Fatalf("%s: unexpected blogs %+v", version, blogs)
+		}
+
+		src, _ = source()
+		streamed := []td.PgxBlog{}
+		err = carta.StreamSource(src, func(b td.PgxBlog) error {
+			streamed = append(streamed, b)
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(streamed, blogs) {
+			log.Fatalf("%s: unexpected streamed blogs %+v, %v", version, streamed, err)
+		}
+	}
+	if _, err := carta.PgxRows(&td.PgxRows{}).Columns(); err == nil {
+		log.Fatal("expected error for rows without field descriptions")
+	}
+}
+
+func TestGenericMap(m *testing.T) {
+	for dbName, rows := range query(td.BlogQuery) {
+		resp, err := carta.MapAll[td.Blog](rows)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		mapped := []td.Blog{}
+		if err := carta.Map(query(td.BlogQuery)[dbName], &mapped); err != nil {
+			log.Fatal(err.Error())
+		}
+		all, _ := json.Marshal(resp)
+		ans, _ := json.Marshal(mapped)
+		if string(all) != string(ans) {
+			log.Fatal(errors.New("Test Generic Map Produced Inconsistent Results"))
+		}
+		if _, err := carta.MapOne[td.Blog](query(td.BlogQuery)[dbName]); !errors.Is(err, carta.ErrTooManyRows) {
+			log.Fatalf("%s: expected carta.ErrTooManyRows, got %v", dbName, err)
+		}
+		if first, err := carta.MapFirst[*td.Blog](query(td.BlogQuery)[dbName]); err != nil || first.BlogId != mapped[0].BlogId {
+			log.Fatalf("%s: unexpected first blog, %v", dbName, err)
+		}
+	}
+}
+
+func TestKeys(m *testing.T) {
+	for dbName, rows := range query(td.KeyedBlogQuery) {
+		resp := []td.KeyedBlog{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 || len(resp[0].Posts) != 2 || len(resp[1].Posts) != 1 {
+			log.Fatalf("%s: blogs were not resolved by key, %+v", dbName, resp)
+		}
+	}
+}
+
+func TestScanner(m *testing.T) {
+	for dbName, rows := range query(td.ScannerQuery) {
+		resp := []td.ScannerTest{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 || resp[0].Amount != 1250 || resp[0].Refund != nil || resp[1].Amount != 300 || *resp[1].Refund != 50 {
+			log.Fatalf("%s: scanner fields were not loaded, %+v", dbName, resp)
+		}
+	}
+}
+
+func TestConverter(m *testing.T) {
+	carta.RegisterConverter(reflect.TypeOf(td.Weekday(0)), func(cell *value.Cell) (interface{}, error) {
+		day, err := cell.String()
+		if err != nil {
+			return nil, err
+		}
+		switch day {
+		case "monday":
+			return td.Monday, nil
+		case "tuesday":
+			return td.Tuesday, nil
+		}
+		return nil, errors.New("unknown day " + day)
+	})
+	for dbName, rows := range query(td.ConverterQuery) {
+		resp := []td.ConverterTest{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 || resp[0].Day != td.Monday || resp[0].Off != nil || resp[1].Day != td.Tuesday || *resp[1].Off != td.Monday {
+			log.Fatalf("%s: converted fields were not loaded, %+v", dbName, resp)
+		}
+	}
+}
+
+func TestBytes(m *testing.T) {
+	respPG := []td.BytesTest{}
+	if err := carta.Map(queryPG(td.BytesQueryPG), &respPG); err != nil {
+		log.Fatal(err.Error())
+	}
+	respMySQL := []td.BytesTest{}
+	if err := carta.Map(queryMysql(td.BytesQueryMySQL), &respMySQL); err != nil {
+		log.Fatal(err.Error())
+	}
+	ansPG, _ := json.Marshal(respPG)
+	ansMySQL, _ := json.Marshal(respMySQL)
+	if string(ansPG) != string(ansMySQL) {
+		log.Fatal(errors.New("Test Bytes Produced Inconsistent Results"))
+	}
+	if len(respPG) != 1 || string(respPG[0].Data) != "\x00\xff\x10" || respPG[0].Thumb != nil ||
+		string(respPG[0].Meta) != `{"a": 1}` || respPG[0].Hash != [4]byte{0xde, 0xad, 0xbe, 0xef} {
+		log.Fatalf("binary fields were not loaded, %+v", respPG)
+	}
+}
+
+func TestJSON(m *testing.T) {
+	for dbName, rows := range query(td.JSONQuery) {
+		resp := []td.JSONTest{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 || resp[0].Settings.Theme != "dark" || resp[0].Extra["beta"] != true ||
+			len(*resp[0].Labels) != 2 || resp[1].Extra != nil || resp[1].Labels != nil {
+			log.Fatalf("%s: json fields were not decoded, %+v", dbName, resp)
+		}
+	}
+}
+
+func TestJSONAgg(m *testing.T) {
+	for dbName, rows := range query(td.JSONAggQuery) {
+		resp := []td.JSONAggBlog{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 || len(resp[0].Posts) != 2 || resp[1].Posts == nil || len(resp[1].Posts) != 0 || resp[1].Latest != nil {
+			log.Fatalf("%s: aggregated json was not loaded, %+v", dbName, resp)
+		}
+		first, second := resp[0].Posts[0], resp[0].Posts[1]
+		if first.PostId != 1 || *first.Subject != "first" || first.Author.AuthorId != 7 || first.Author.Username != "ann" ||
+			len(first.Tags) != 2 || second.Subject != nil || second.Author != nil || second.Tags != nil {
+			log.Fatalf("%s: aggregated posts were not loaded, %+v", dbName, resp[0].Posts)
+		}
+		if resp[0].Latest == nil || resp[0].Latest.PostId != 2 {
+			log.Fatalf("%s: aggregated has-one relationship was not loaded, %+v", dbName, resp[0].Latest)
+		}
+	}
+}
+
+func TestArray(m *testing.T) {
+	resp := []td.ArrayTest{}
+	if err := carta.Map(queryPG(td.ArrayQueryPG), &resp); err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(resp) != 2 {
+		log.Fatalf("expected 2 rows, got %d", len(resp))
+	}
+	first, second := resp[0], resp[1]
+	if !reflect.DeepEqual(first.Ints, []int64{1, 2, 3}) || len(first.Texts) != 3 || *first.Texts[0] != "a b" ||
+		first.Texts[1] != nil || *first.Texts[2] != `c"d` || !reflect.DeepEqual(first.Grid, [][]float64{{1.5, 2}, {3, 4}}) ||
+		!first.Times[0].Equal(time.Date(2004, 10, 19, 8, 23, 54, 0, time.UTC)) || !reflect.DeepEqual(*first.Flags, []bool{true, false}) ||
+		!first.Labels[0].Valid || first.Labels[1].Valid {
+		log.Fatalf("array columns were not parsed, %+v", first)
+	}
+	if second.Ints == nil || len(second.Ints) != 0 || second.Texts != nil || second.Flags != nil {
+		log.Fatalf("empty and null arrays were not loaded, %+v", second)
+	}
+}
+
+func TestEmbedded(m *testing.T) {
+	for dbName, rows := range query(td.EmbeddedQuery) {
+		resp := []td.Manager{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 1 {
+			log.Fatalf("%s: expected 1 manager, got %d", dbName, len(resp))
+		}
+		manager := resp[0]
+		if manager.Id != 1 || manager.Name != "ann" || manager.Note != "boss" || manager.Person.Note != "" ||
+			manager.Audit == nil || manager.CreatedBy != "root" {
+			log.Fatalf("%s: embedded fields were not promoted, %+v", dbName, manager)
+		}
+		if len(manager.Reports) != 2 || manager.Reports[0].Name != "bob" || manager.Reports[1].Id != 4 || manager.Mentor.Name != "cid" {
+			log.Fatalf("%s: relationships of a struct with embedded fields were not mapped, %+v", dbName, manager)
+		}
+	}
+}
+
+func TestMapCollection(m *testing.T) {
+	for dbName, rows := range query(td.MapQuery) {
+		resp := []td.MapUser{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 {
+			log.Fatalf("%s: expected 2 users, got %d", dbName, len(resp))
+		}
+		settings, logins := resp[0].Settings, resp[0].Logins
+		if len(settings) != 2 || *settings["theme"].Value != "dark" || *settings["lang"].Value != "en" ||
+			len(logins) != 2 || *logins[1].Ip != "10.0.0.1" || *logins[2].Ip != "10.0.0.1" {
+			log.Fatalf("%s: map collections were not loaded, %+v", dbName, resp[0])
+		}
+		// elements with null keys are not added
+		if resp[1].Settings == nil || len(resp[1].Settings) != 0 || len(resp[1].Logins) != 0 {
+			log.Fatalf("%s: expected empty maps, %+v", dbName, resp[1])
+		}
+	}
+	for dbName, rows := range query(td.MapQuery) {
+		resp := []td.MapValueUser{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		// null rows of the outer join are skipped, rather than loaded onto a non-pointer key
+		if len(resp) != 2 || resp[0].Settings["lang"].Value != "en" || len(resp[1].Settings) != 0 {
+			log.Fatalf("%s: unexpected settings %+v", dbName, resp)
+		}
+	}
+	for dbName, rows := range query(td.MapQuery) {
+		resp := []td.MapIntKeyUser{}
+		if err := carta.Map(rows, &resp); err == nil || !strings.Contains(err.Error(), "cannot be used as a key of map") {
+			log.Fatalf("%s: expected key type error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.MapDuplicateKeyQuery) {
+		resp := []td.MapUser{}
+		if err := carta.Map(rows, &resp); err == nil || !strings.Contains(err.Error(), "duplicate key theme") {
+			log.Fatalf("%s: expected duplicate key error, got %v", dbName, err)
+		}
+	}
+}
+
+func TestVariants(m *testing.T) {
+	for dbName, rows := range query(td.VariantQuery) {
+		resp := []td.Customer{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		if len(resp) != 2 || len(resp[0].Methods) != 2 {
+			log.Fatalf("%s: polymorphic collection was not loaded, %+v", dbName, resp)
+		}
+		card, isCard := resp[0].Methods[0].(td.Card)
+		bank, isBank := resp[0].Methods[1].(*td.BankAccount)
+		if !isCard || card.Number != "4242" || !isBank || bank.Iban != "DE89" {
+			log.Fatalf("%s: unexpected variants, %+v", dbName, resp[0].Methods)
+		}
+		if primary, ok := resp[0].Primary.(*td.BankAccount); !ok || primary.Label() != "bank DE89" {
+			log.Fatalf("%s: unexpected primary variant, %+v", dbName, resp[0].Primary)
+		}
+		// null discriminators do not load elements
+		if len(resp[1].Methods) != 0 || resp[1].Primary != nil {
+			log.Fatalf("%s: unexpected variants, %+v", dbName, resp[1])
+		}
+	}
+}
+
+func TestNamingStrategy(m *testing.T) {
+	want := td.NamingBlog{BlogId: 1, Writer: td.NamingAuthor{AuthorId: 2, Username: "ann"}}
+
+	camel := []td.NamingBlog{}
+	if err := carta.Map(queryPG(td.CamelCaseQueryPG), &camel, carta.WithNamingStrategy(carta.CamelCase{})); err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(camel) != 1 || camel[0] != want {
+		log.Fatalf("camel case columns were not mapped, %+v", camel)
+	}
+
+	upper := []td.NamingBlog{}
+	if err := carta.Map(queryPG(td.UpperCaseQueryPG), &upper, carta.WithNamingStrategy(carta.CaseInsensitive{Separator: "__"})); err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(upper) != 1 || upper[0] != want {
+		log.Fatalf("upper case columns were not mapped, %+v", upper)
+	}
+
+	// the same columns and destination are cached separately for every strategy
+	exact := []td.NamingBlog{}
+	if err := carta.Map(queryPG(td.ExactQueryPG), &exact, carta.WithNamingStrategy(carta.Exact{})); err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(exact) != 1 || exact[0].Writer.AuthorId != 2 || exact[0].Writer.Username != "" {
+		log.Fatalf("exact naming matched columns in a different case, %+v", exact)
+	}
+	insensitive := []td.NamingBlog{}
+	if err := carta.Map(queryPG(td.ExactQueryPG), &insensitive, carta.WithNamingStrategy(carta.CaseInsensitive{})); err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(insensitive) != 1 || insensitive[0] != want {
+		log.Fatalf("case insensitive naming did not match, %+v", insensitive)
+	}
+
+	if names := (carta.CamelCase{}).ColumnNames("author_id", []string{"writer"}); !reflect.DeepEqual(names, []string{"author_id", "authorId", "writerAuthorId"}) {
+		log.Fatalf("unexpected camel case candidates %v", names)
+	}
+}
+
+func TestAmbiguousColumns(m *testing.T) {
+	for dbName, rows := range query(td.AmbiguousQuery) {
+		resp := []td.Team{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatal(err.Error())
+		}
+		// the field declared first claims the column
+		if len(resp) != 1 || resp[0].Lead.Name != "ann" || resp[0].Lead.Id != 3 || len(resp[0].Members) != 1 || resp[0].Members[0].Name != "" {
+			log.Fatalf("%s: unexpected allocation of ambiguous column, %+v", dbName, resp)
+		}
+	}
+	for dbName, rows := range query(td.AmbiguousQuery) {
+		resp := []td.Team{}
+		err := carta.Map(rows, &resp, carta.WithAmbiguityErrors())
+		if err == nil || !strings.Contains(err.Error(), "column name is ambiguous") ||
+			!strings.Contains(err.Error(), "testdata.Team.Lead.Name, testdata.Team.Members.Name") {
+			log.Fatalf("%s: expected ambiguity error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.PrefixedQuery) {
+		resp := []td.Team{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		// only the best match of a field is claimed, other matching columns are left for other fields
+		if len(resp) != 1 || resp[0].Lead.Name != "bob" || len(resp[0].Members) != 1 || resp[0].Members[0].Name != "ann" {
+			log.Fatalf("%s: unexpected allocation of prefixed columns, %+v", dbName, resp)
+		}
+	}
+}
+
+func TestStrict(m *testing.T) {
+	strict := carta.WithStrict(carta.StrictColumns | carta.StrictFields)
+	for dbName, rows := range query(td.StrictQuery) {
+		resp := []td.StrictBlog{}
+		if err := carta.Map(rows, &resp, strict); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.StrictTypoQuery) {
+		resp := []td.StrictBlog{}
+		err := carta.Map(rows, &resp, carta.WithStrict(carta.StrictColumns))
+		if err == nil || err.Error() != "carta: columns titel, subjcet are not mapped onto any field of testdata.StrictBlog" {
+			log.Fatalf("%s: expected unmapped columns error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.StrictTypoQuery) {
+		resp := []td.StrictBlog{}
+		err := carta.Map(rows, &resp, carta.WithStrict(carta.StrictFields))
+		if err == nil || err.Error() != "carta: fields testdata.StrictBlog.Title, testdata.StrictBlog.Posts.Subject have no column" {
+			log.Fatalf("%s: expected unfilled fields error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.StrictShadowedQuery) {
+		resp := []td.StrictBlog{}
+		err := carta.Map(rows, &resp, carta.WithStrict(carta.StrictColumns))
+		if err == nil || err.Error() != "carta: columns subject are not mapped onto any field of testdata.StrictBlog" {
+			log.Fatalf("%s: expected shadowed column error, got %v", dbName, err)
+		}
+	}
+}
+
+func TestRecursive(m *testing.T) {
+	for dbName, rows := range query(td.RecursiveQuery) {
+		resp := []td.Category{}
+		err := carta.Map(rows, &resp)
+		if err == nil || !strings.Contains(err.Error(), "testdata.Category is recursive") {
+			log.Fatalf("%s: expected recursive type error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.RecursiveQuery) {
+		resp := []td.Category{}
+		if err := carta.Map(rows, &resp, carta.WithMaxDepth(3)); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if len(resp) != 2 || len(resp[0].Children) != 2 || len(resp[1].Children) != 0 {
+			log.Fatalf("%s: unexpected categories %+v", dbName, resp)
+		}
+		if resp[0].Children[1].Name != "poetry" || resp[0].Children[1].Children != nil {
+			log.Fatalf("%s: unexpected subcategory %+v", dbName, resp[0].Children[1])
+		}
+	}
+}
+
+func TestTree(m *testing.T) {
+	for dbName, rows := range query(td.TreeQuery) {
+		resp := []td.TreeCategory{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if len(resp) != 2 || resp[0].Name != "books" || resp[1].Name != "music" || len(resp[1].Children) != 0 {
+			log.Fatalf("%s: unexpected roots %+v", dbName, resp)
+		}
+		books := resp[0]
+		if len(books.Children) != 2 || books.Children[0].Name != "fiction" || books.Children[1].Name != "poetry" {
+			log.Fatalf("%s: unexpected children %+v", dbName, books.Children)
+		}
+		if len(books.Children[0].Children) != 1 || books.Children[0].Children[0].Name != "crime" {
+			log.Fatalf("%s: unexpected grandchildren %+v", dbName, books.Children[0].Children)
+		}
+	}
+	for dbName, rows := range query(td.TreeOrphanQuery) {
+		resp := []td.TreeCategory{}
+		err := carta.Map(rows, &resp)
+		if err == nil || err.Error() != "carta: parent of testdata.TreeCategory 2 not found" {
+			log.Fatalf("%s: expected orphan error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.TreeCycleQuery) {
+		resp := []td.TreeCategory{}
+		err := carta.Map(rows, &resp)
+		if err == nil || err.Error() != "carta: testdata.TreeCategory 2 is part of a cycle" {
+			log.Fatalf("%s: expected cycle error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.TreeTextParentQuery) {
+		resp := []td.TreeCategory{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if len(resp) != 1 || len(resp[0].Children) != 1 || resp[0].Children[0].Name != "fiction" {
+			log.Fatalf("%s: parent arriving as text was not matched, %+v", dbName, resp)
+		}
+	}
+}
+
+func TestMapResultSets(m *testing.T) {
+	blogs := []td.ResultSetBlog{}
+	authors := []td.ResultSetAuthor{}
+	if err := carta.MapResultSets(queryPG(td.ResultSetsQuery), []interface{}{&blogs, &authors}); err != nil {
+		log.Fatal(err)
+	}
+	if len(blogs) != 2 || blogs[1].Title != "second" || len(authors) != 1 || authors[0].Name != "ann" {
+		log.Fatalf("unexpected result sets %+v %+v", blogs, authors)
+	}
+	err := carta.MapResultSets(queryPG(td.ResultSetsQuery), []interface{}{&blogs})
+	if err == nil || err.Error() != "carta: 1 destinations, but more result sets were returned" {
+		log.Fatalf("expected too many result sets error, got %v", err)
+	}
+	err = carta.MapResultSets(queryPG(td.ResultSetsQuery), []interface{}{&blogs, &authors, &authors})
+	if err == nil || err.Error() != "carta: 3 destinations, but only 2 result sets were returned" {
+		log.Fatalf("expected too few result sets error, got %v", err)
+	}
+	err = carta.MapResultSets(queryPG(td.ResultSetsQuery), []interface{}{&blogs, authors})
+	if err == nil || err.Error() != "carta: cannot map rows onto []testdata.ResultSetAuthor, destination must be pointer to a slice(*[]), pointer to a struct or pointer to a basic type (result set 2)" {
+		log.Fatalf("expected destination error of the second result set, got %v", err)
+	}
+}
+
+func TestMapInto(m *testing.T) {
+	blogs := []td.IntoBlog{}
+	if err := carta.Map(queryPG(td.IntoBlogQuery), &blogs); err != nil {
+		log.Fatal(err)
+	}
+	if err := carta.MapInto(queryPG(td.IntoPostQuery), &blogs, "Posts"); err != nil {
+		log.Fatal(err)
+	}
+	if len(blogs) != 3 || len(blogs[0].Posts) != 2 || len(blogs[1].Posts) != 1 || len(blogs[2].Posts) != 0 {
+		log.Fatalf("unexpected blogs %+v", blogs)
+	}
+	if blogs[0].Posts[0].Subject != "hello" || blogs[0].Posts[1].Subject != "world" || blogs[1].Posts[0].Subject != "again" {
+		log.Fatalf("unexpected posts %+v %+v", blogs[0].Posts, blogs[1].Posts)
+	}
+	err := carta.MapInto(queryPG(td.IntoPostQuery), &blogs, "Title")
+	if err == nil || err.Error() != "carta: field testdata.IntoBlog.Title is not a has-one or has-many relationship" {
+		log.Fatalf("expected relationship error, got %v", err)
+	}
+}
+
+func TestScalarRoots(m *testing.T) {
+	for dbName, rows := range query(td.ScalarQuery) {
+		resp := []int64{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if !reflect.DeepEqual(resp, []int64{1, 2}) {
+			log.Fatalf("%s: unexpected values %v", dbName, resp)
+		}
+	}
+	for dbName, rows := range query(td.ScalarQuery) {
+		resp := []int64{}
+		if err := carta.Map(rows, &resp, carta.KeepDuplicates()); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if !reflect.DeepEqual(resp, []int64{1, 2, 1}) {
+			log.Fatalf("%s: unexpected values %v", dbName, resp)
+		}
+	}
+	for dbName, rows := range query(td.ScalarColumnQuery) {
+		var title string
+		if err := carta.Map(rows, &title, carta.WithColumn("title")); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if title != "first" {
+			log.Fatalf("%s: unexpected title %q", dbName, title)
+		}
+	}
+	for dbName, rows := range query(td.ScalarColumnQuery) {
+		var title string
+		err := carta.Map(rows, &title)
+		if err == nil || !strings.Contains(err.Error(), "found 2 columns") {
+			log.Fatalf("%s: expected single column error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.ScalarColumnQuery) {
+		var title *string
+		if err := carta.Map(rows, &title, carta.WithColumn("title")); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if title == nil || *title != "first" {
+			log.Fatalf("%s: pointer to the title was not allocated, %v", dbName, title)
+		}
+	}
+	for dbName, rows := range query(td.ScalarNullQuery) {
+		var title *string
+		if err := carta.Map(rows, &title); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if title != nil {
+			log.Fatalf("%s: pointer was set for a null value, %q", dbName, *title)
+		}
+	}
+	for dbName, rows := range query(td.ScalarQuery) {
+		var n int64
+		if err := carta.Map(rows, &n); !errors.Is(err, carta.ErrTooManyRows) {
+			log.Fatalf("%s: expected too many rows error, got %v", dbName, err)
+		}
+	}
+	for dbName, rows := range query(td.ScalarBytesQuery) {
+		var b []byte
+		if err := carta.Map(rows, &b); !errors.Is(err, carta.ErrTooManyRows) {
+			log.Fatalf("%s: expected too many rows error for bytes, got %v", dbName, err)
+		}
+	}
+}
+
+func TestKeyBy(m *testing.T) {
+	for dbName, rows := range query(td.KeyByQuery) {
+		resp := []td.KeyByPost{}
+		if err := carta.Map(rows, &resp); err != nil {
+			log.Fatalf("%s: %s", dbName, err)
+		}
+		if len(resp) != 1 {
+			log.Fatalf("%s: unexpected posts %+v", dbName, resp)
+		}
+		// values are deduplicated, unless keyed by row or by a column
+		if !reflect.DeepEqual(resp[0].Labels, []string{"go", "sql"}) {
+			log.Fatalf("%s: unexpected labels %v", dbName, resp[0].Labels)
+		}
+		if !reflect.DeepEqual(resp[0].Repeated, []string{"go", "go", "sql"}) {
+			log.Fatalf("%s: unexpected labels keyed by row %v", dbName, resp[0].Repeated)
+		}
+		if !reflect.DeepEqual(resp[0].Readings, []int{5, 5}) {
+			log.Fatalf("%s: unexpected readings keyed by column %v", dbName, resp[0].Readings)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package carta
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NamingStrategy determines which columns map onto a field.
+// Field names are the names in the db tag, or the go field names when a tag is not used,
+// ancestor names are the names of the struct fields the field is nested in, outermost first, ie ["writer"] for Blog.Writer.AuthorId.
+// A columns maps onto a field if its normalized name is one of the candidates.
+type NamingStrategy interface {
+	// ColumnNames returns the candidate column names of a field,
+	// the field name is empty for slices of basic types, ie []string, where columns are named after ancestors only
+	ColumnNames(fieldName string, ancestorNames []string) []string
+	// NormalizeColumn is applied to column names before they are compared with candidates,
+	// ie strings.ToLower for case insensitive strategies
+	NormalizeColumn(column string) string
+}
+
+// SnakeCase is the default naming strategy, a field matches its name, the snake case and the lower case of its name,
+// on their own or prefixed with the names of ancestors, joined with the separator, which is "_" unless set
+// Writer Author `db:"writer"` with AuthorId int => "AuthorId", "author_id", "authorid", "writer_AuthorId", "writer_author_id", ...
+type SnakeCase struct {
+	Separator string
+}
+
+func (s SnakeCase) ColumnNames(fieldName string, ancestorNames []string) []string {
+	return prefixedNames(fieldName, ancestorNames, separator(s.Separator), func(name string) []string {
+		return []string{name, toSnakeCase(name), strings.ToLower(name)}
+	})
+}
+
+func (s SnakeCase) NormalizeColumn(column string) string {
+	return column
+}
+
+// CamelCase matches fields with columns in camel case, ie "authorId", or "writerAuthorId" when prefixed with ancestor names,
+// as well as with their exact names
+type CamelCase struct{}
+
+func (CamelCase) ColumnNames(fieldName string, ancestorNames []string) []string {
+	names := []string{}
+	if fieldName != "" {
+		names = append(names, fieldName, lowerFirst(toCamelCase(fieldName)))
+	}
+	nameConcat := toCamelCase(fieldName)
+	for i := len(ancestorNames) - 1; i >= 0; i-- {
+		nameConcat = upperFirst(toCamelCase(ancestorNames[i])) + upperFirst(nameConcat)
+		names = append(names, lowerFirst(nameConcat))
+	}
+	return names
+}
+
+func (CamelCase) NormalizeColumn(column string) string {
+	return column
+}
+
+// CaseInsensitive matches the same names as SnakeCase, regardless of case, ie "BLOG_ID" for BlogId,
+// which suits databases reporting upper case column names
+type CaseInsensitive struct {
+	Separator string
+}
+
+func (s CaseInsensitive) ColumnNames(fieldName string, ancestorNames []string) []string {
+	names := SnakeCase{Separator: s.Separator}.ColumnNames(fieldName, ancestorNames)
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}
+
+func (CaseInsensitive) NormalizeColumn(column string) string {
+	return strings.ToLower(column)
+}
+
+// Exact only matches the exact name of a field, on its own or prefixed with the exact names of ancestors,
+// joined with the separator, which is "_" unless set
+type Exact struct {
+	Separator string
+}
+
+func (s Exact) ColumnNames(fieldName string, ancestorNames []string) []string {
+	return prefixedNames(fieldName, ancestorNames, separator(s.Separator), func(name string) []string {
+		return []string{name}
+	})
+}
+
+func (Exact) NormalizeColumn(column string) string {
+	return column
+}
+
+func separator(sep string) string {
+	if sep == "" {
+		return "_"
+	}
+	return sep
+}
+
+// prefixedNames returns the forms of the field name, and the forms of the field name prefixed with ancestors,
+// from the closest ancestor to the outermost one
+func prefixedNames(fieldName string, ancestorNames []string, sep string, forms func(string) []string) []string {
+	names := []string{}
+	if fieldName != "" {
+		names = append(names, forms(fieldName)...)
+	}
+	nameConcat := fieldName
+	for i := len(ancestorNames) - 1; i >= 0; i-- {
+		if nameConcat == "" {
+			nameConcat = ancestorNames[i]
+		} else {
+			nameConcat = ancestorNames[i] + sep + nameConcat
+		}
+		names = append(names, forms(nameConcat)...)
+	}
+	return names
+}
+
+// toCamelCase converts snake case names to camel case, ie author_id to authorId, other names are left unchanged
+func toCamelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = upperFirst(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
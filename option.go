@@ -0,0 +1,106 @@
+package carta
+
+import (
+	"fmt"
+
+	"github.com/jackskj/carta/value"
+)
+
+// Option configures a mapping, options are passed to Map and the other mapping functions
+//
+//	carta.Map(rows, &blogs, carta.WithNamingStrategy(carta.CamelCase{}))
+type Option func(*options)
+
+type options struct {
+	naming          NamingStrategy
+	ambiguityErrors bool
+	strict          StrictMode
+	maxDepth        int
+	column          string
+	keepDuplicates  bool
+	timeParser      *value.TimeParser
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		naming: SnakeCase{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// key identifies the options in the mapper cache, mappers generated with different options are cached separately
+func (o *options) key() string {
+	return fmt.Sprintf("%T%+v|%t|%d|%d|%s|%t", o.naming, o.naming, o.ambiguityErrors, o.strict, o.maxDepth, o.column, o.keepDuplicates)
+}
+
+// WithNamingStrategy sets the strategy used to match columns with fields, SnakeCase is used by default
+func WithNamingStrategy(naming NamingStrategy) Option {
+	return func(o *options) {
+		o.naming = naming
+	}
+}
+
+// WithAmbiguityErrors makes mapping fail when a column is the best match of more than one field,
+// the error lists every field which could claim the column.
+// By default, the column is claimed by the field of the shallowest struct, or the field declared first
+func WithAmbiguityErrors() Option {
+	return func(o *options) {
+		o.ambiguityErrors = true
+	}
+}
+
+// StrictMode selects the checks of strict mapping, modes can be combined, ie StrictColumns|StrictFields
+type StrictMode int
+
+const (
+	// StrictColumns fails mapping when a column is not mapped onto any field
+	StrictColumns StrictMode = 1 << iota
+	// StrictFields fails mapping when a field has no column, fields tagged with the "optional" option are exempt
+	StrictFields
+)
+
+// WithStrict enables the checks of the strict mode, mapping then fails with an error listing every offending column or field
+func WithStrict(mode StrictMode) Option {
+	return func(o *options) {
+		o.strict |= mode
+	}
+}
+
+// WithMaxDepth allows recursive structs, ie type Category struct { Children []Category }, to be nested up to depth times in themselves,
+// columns of nested levels are prefixed as usual, ie "children_id", "children_children_id".
+// Nested levels which do not map onto any column are left out, the mapping of recursive types otherwise fails
+func WithMaxDepth(depth int) Option {
+	return func(o *options) {
+		o.maxDepth = depth
+	}
+}
+
+// WithColumn names the column of basic destinations, ie *[]int64 or *time.Time, which otherwise take the only column of the rows
+func WithColumn(column string) Option {
+	return func(o *options) {
+		o.column = column
+	}
+}
+
+// KeepDuplicates keys elements of basic destinations, ie *[]string, by the position of their row rather than by their value,
+// therefore every row adds an element, including duplicate values
+func KeepDuplicates() Option {
+	return func(o *options) {
+		o.keepDuplicates = true
+	}
+}
+
+// WithTimeParser parses time values which arrive as text with p, rather than with the default layouts,
+// ie to parse values without a time zone in a different location
+//
+//	p := value.NewTimeParser()
+//	p.Location = time.Local
+//	err := carta.Map(rows, &blogs, carta.WithTimeParser(p))
+func WithTimeParser(p *value.TimeParser) Option {
+	return func(o *options) {
+		o.timeParser = p
+	}
+}
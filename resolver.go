@@ -1,14 +1,20 @@
 package carta
 
 import (
+	"database/sql/driver"
 	"reflect"
+	"time"
+
+	"github.com/jackskj/carta/value"
 )
 
 // Resolver determines whether an object has already appeared in past rows.
 // ie, if a set of column values was previously returned by SQL,
 // this is nececaty to determine whether a new instantiation of a type is necesarry
 // Carta uses all present columns in a particular message to generate a unique id,
+// (or the key columns, if declared with the "pk" tag option)
 // if successive rows have the same id, it identifies the same element
+// the id is a concatenation of typed, length prefixed cell values, therefore distinct values never share an id
 // always include a uniquely identifiable column in your query
 // resolver cannot be stored in pointer reciver, this would result in concurrency bugs,
 //
@@ -30,11 +36,16 @@ type (
 type element struct {
 	v       reflect.Value // value of a struct that is mapped, this is never a pointer, its either a primative or struct
 	subMaps map[fieldIndex]*resolver
+	key     reflect.Value // key of the element in a parent map, invalid if the key is null, used only by dictionaries
+	variant *Mapper       // mapper of the concrete type of a polymorphic element
+
+	treeKey, treeParent interface{} // keys of the node and its parent, used only by trees, the parent key of roots is nil
 }
 
 type resolver struct {
 	elements     map[uniqueValId]*element
 	elementOrder []uniqueValId // all elements stored in an order, important for the " order by " clause, earlier rows that map onto elements will be earlies in this slice
+	rowCount     int           // number of sql rows loaded, only tracked by the top level resolver
 }
 
 func newResolver() *resolver {
@@ -43,3 +54,52 @@ func newResolver() *resolver {
 		elements:     map[uniqueValId]*element{},
 	}
 }
+
+// timeKey is the comparable value of a time, same instants in different locations are the same key
+type timeKey struct {
+	sec  int64
+	nsec int
+}
+
+// keyValue returns a comparable value of a key field, values of driver.Valuer types are compared by the value they store,
+// ie a decimal backed by a *big.Int, nil is returned for nil pointers and null values
+func keyValue(field reflect.Value) (interface{}, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+	v := field.Interface()
+	valuer, ok := v.(driver.Valuer)
+	if !ok && field.CanAddr() {
+		// driver.Valuer implemented with a pointer receiver
+		valuer, ok = field.Addr().Interface().(driver.Valuer)
+	}
+	if ok {
+		var err error
+		if v, err = valuer.Value(); err != nil {
+			return nil, err
+		}
+	}
+	if t, ok := v.(time.Time); ok {
+		return timeKey{t.Unix(), t.Nanosecond()}, nil
+	}
+	if b := reflect.ValueOf(v); b.Kind() == reflect.Slice && b.Type().Elem().Kind() == reflect.Uint8 {
+		return string(b.Bytes()), nil
+	}
+	return v, nil
+}
+
+var valuerTyp = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// test whether values of key fields of the type can be compared, see keyValue
+func isComparableKey(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(valuerTyp) || reflect.PtrTo(t).Implements(valuerTyp) || value.IsBytes(t) {
+		return true
+	}
+	return t.Comparable()
+}
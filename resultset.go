@@ -0,0 +1,43 @@
+package carta
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MapResultSets maps every result set of rows onto the destination of the same position,
+// ie rows of a stored procedure or a batch of queries, each result set is mapped as it would be by Map
+//
+//	err := carta.MapResultSets(rows, []interface{}{&blogs, &authors, &stats})
+//
+// The number of result sets must match the number of destinations, options apply to every result set,
+// rows are always closed. Errors of a result set are suffixed with its position, ie "(result set 2)"
+func MapResultSets(rows *sql.Rows, dsts []interface{}, opts ...Option) error {
+	return MapResultSetsContext(context.Background(), rows, dsts, opts...)
+}
+
+// MapResultSetsContext is like MapResultSets, but stops mapping once ctx is done, see MapContext
+func MapResultSetsContext(ctx context.Context, rows *sql.Rows, dsts []interface{}, opts ...Option) error {
+	defer rows.Close()
+	if len(dsts) == 0 {
+		return fmt.Errorf("carta: no destinations for result sets")
+	}
+	o := newOptions(opts)
+	src := SQLRows(rows)
+	for i, dst := range dsts {
+		if i != 0 && !rows.NextResultSet() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("carta: %d destinations, but only %d result sets were returned", len(dsts), i)
+		}
+		if err := mapResultSet(ctx, src, dst, o); err != nil {
+			return fmt.Errorf("%w (result set %d)", err, i+1)
+		}
+	}
+	if rows.NextResultSet() {
+		return fmt.Errorf("carta: %d destinations, but more result sets were returned", len(dsts))
+	}
+	return rows.Err()
+}
@@ -1,82 +1,115 @@
 package carta
 
 import (
+	"context"
 	"errors"
 	"reflect"
 )
 
-func setDst(m *Mapper, dst reflect.Value, rsv *resolver) error {
+func setDst(ctx context.Context, m *Mapper, dst reflect.Value, rsv *resolver) error {
 	// dst is  always a pointer
 	dstIndirect := reflect.Indirect(dst)
 
 	// post order traversal, first set all submap structs, then the struct itself
 	for _, uid := range rsv.elementOrder {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		elem := rsv.elements[uid]
+		em := m // mapper of the element
+		if elem.variant != nil {
+			em = elem.variant
+		}
 
 		//set childeren first
 		for fieldIndex, subMapRsv := range elem.subMaps {
-			var (
-				subMap       *Mapper
-				childTyp     reflect.Type
-				childDst     reflect.Value
-				newChildElem reflect.Value
-				ok           bool
-			)
-
-			if subMap, ok = m.SubMaps[fieldIndex]; !ok {
+			subMap, ok := em.SubMaps[fieldIndex]
+			if !ok {
 				// this should never happen
 				return errors.New("carta: sub map not found")
 			}
-			if f, ok := m.SubMaps[fieldIndex]; ok {
-				childTyp = f.Typ
-			} else {
-				// this should never happen
-				return errors.New("carta: field not found")
-			}
-
-			if subMap.Crd == Collection {
-				capacity := len(subMapRsv.elements)
-				if subMap.IsTypePtr {
-					newChildElem = reflect.New(reflect.SliceOf(reflect.PtrTo(childTyp))).Elem()
-					newChildElem.Set(reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(childTyp)), 0, capacity))
-				} else {
-					newChildElem = reflect.New(reflect.SliceOf(childTyp)).Elem()
-					newChildElem.Set(reflect.MakeSlice(reflect.SliceOf(childTyp), 0, capacity))
-				}
-				if subMap.IsListPtr {
-					elem.v.Field(int(fieldIndex)).Set(newChildElem.Addr())
-					childDst = elem.v.Field(int(fieldIndex))
-				} else {
-					elem.v.Field(int(fieldIndex)).Set(newChildElem)
-					childDst = elem.v.Field(int(fieldIndex)).Addr()
-				}
-			} else if subMap.Crd == Association {
-				newChildElem = reflect.New(childTyp).Elem()
-				if subMap.IsTypePtr {
-					elem.v.Field(int(fieldIndex)).Set(newChildElem.Addr())
-					childDst = elem.v.Field(int(fieldIndex))
-				} else {
-					elem.v.Field(int(fieldIndex)).Set(newChildElem)
-					childDst = elem.v.Field(int(fieldIndex)).Addr()
-				}
+			if err := setSubMap(ctx, subMap, em.field(elem.v, fieldIndex), subMapRsv); err != nil {
+				return err
 			}
-
-			// setting the child
-			setDst(subMap, childDst, subMapRsv)
 		}
 	}
 
-	for _, uid := range rsv.elementOrder {
+	order := rsv.elementOrder
+	if m.tree != nil {
+		// only roots are set, other elements are children of their parents
+		var err error
+		if order, err = linkTree(m, rsv); err != nil {
+			return err
+		}
+	}
+	for _, uid := range order {
 		elem := rsv.elements[uid]
+		v := elem.v
+		if m.IsTypePtr || (elem.variant != nil && elem.variant.IsTypePtr) {
+			v = elem.v.Addr()
+		}
 		if m.Crd == Collection {
-			if m.IsTypePtr {
-				dstIndirect.Set(reflect.Append(dstIndirect, elem.v.Addr()))
-			} else {
-				dstIndirect.Set(reflect.Append(dstIndirect, elem.v))
+			dstIndirect.Set(reflect.Append(dstIndirect, v))
+		} else if m.Crd == Dictionary {
+			if err := setMapIndex(m, dstIndirect, elem.key, v); err != nil {
+				return err
 			}
 		} else if m.Crd == Association {
-			dstIndirect.Set(elem.v)
+			if elem.variant != nil {
+				dstIndirect.Set(v)
+			} else if m.valuePtr {
+				dstIndirect.Set(elem.v.Addr())
+			} else {
+				dstIndirect.Set(elem.v)
+			}
 		}
 	}
 	return nil
 }
+
+// setSubMap sets field, a has-one or has-many relationship of a struct, with the elements of the resolver
+func setSubMap(ctx context.Context, subMap *Mapper, field reflect.Value, rsv *resolver) error {
+	var (
+		childTyp     = subMap.Typ
+		childDst     reflect.Value
+		newChildElem reflect.Value
+	)
+
+	if subMap.Crd == Collection {
+		capacity := len(rsv.elements)
+		if subMap.IsTypePtr {
+			newChildElem = reflect.New(reflect.SliceOf(reflect.PtrTo(childTyp))).Elem()
+			newChildElem.Set(reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(childTyp)), 0, capacity))
+		} else {
+			newChildElem = reflect.New(reflect.SliceOf(childTyp)).Elem()
+			newChildElem.Set(reflect.MakeSlice(reflect.SliceOf(childTyp), 0, capacity))
+		}
+		if subMap.IsListPtr {
+			field.Set(newChildElem.Addr())
+			childDst = field
+		} else {
+			field.Set(newChildElem)
+			childDst = field.Addr()
+		}
+	} else if subMap.Crd == Dictionary {
+		valTyp := childTyp
+		if subMap.IsTypePtr {
+			valTyp = reflect.PtrTo(childTyp)
+		}
+		newChildElem = reflect.MakeMapWithSize(reflect.MapOf(subMap.KeyTyp, valTyp), len(rsv.elements))
+		field.Set(newChildElem)
+		childDst = field.Addr()
+	} else if subMap.Crd == Association {
+		newChildElem = reflect.New(childTyp).Elem()
+		if subMap.IsTypePtr {
+			field.Set(newChildElem.Addr())
+			childDst = field
+		} else {
+			field.Set(newChildElem)
+			childDst = field.Addr()
+		}
+	}
+
+	// setting the child
+	return setDst(ctx, subMap, childDst, rsv)
+}
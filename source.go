@@ -0,0 +1,166 @@
+package carta
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// RowSource is the set of methods carta needs to read query results,
+// it allows carta to map rows from drivers other than database/sql
+// Use SQLRows to adapt *sql.Rows and PgxRows to adapt rows returned by github.com/jackc/pgx
+//
+// Every mapping function has a variant reading a RowSource, ie MapSource, StreamSource, MapIntoSource and MapAllSource,
+// except for MapResultSets, since a RowSource holds a single result set
+type RowSource interface {
+	// Columns returns the column names of the result set
+	Columns() ([]string, error)
+	// ColumnTypeNames returns the database type names of the columns, ex "VARCHAR", "INT4", "TIMESTAMPTZ",
+	// an empty string can be returned if the type name is not known
+	ColumnTypeNames() ([]string, error)
+	Next() bool
+	// Scan copies the columns of the current row into dest, every element of dest is an sql.Scanner
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// SQLRows adapts *sql.Rows to a RowSource
+func SQLRows(rows *sql.Rows) RowSource {
+	return sqlRows{rows}
+}
+
+type sqlRows struct {
+	*sql.Rows
+}
+
+func (r sqlRows) ColumnTypeNames() ([]string, error) {
+	colTyps, err := r.Rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	colTypNames := make([]string, len(colTyps))
+	for i := 0; i < len(colTyps); i++ {
+		colTypNames[i] = colTyps[i].DatabaseTypeName()
+	}
+	return colTypNames, nil
+}
+
+// PgxRowsSource is the subset of the pgx.Rows interface (github.com/jackc/pgx v4 and v5) which is used by carta.
+// Additionally, rows must have a FieldDescriptions method returning a slice of field descriptions
+// with Name and DataTypeOID fields, as pgx.Rows does.
+// carta does not import pgx, field descriptions are read with reflection
+type PgxRowsSource interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close()
+}
+
+// PgxRows adapts rows returned by pgx, ie conn.Query(ctx, query), to a RowSource
+func PgxRows(rows PgxRowsSource) RowSource {
+	return pgxRows{rows}
+}
+
+type pgxRows struct {
+	PgxRowsSource
+}
+
+func (r pgxRows) Close() error {
+	r.PgxRowsSource.Close()
+	return nil
+}
+
+func (r pgxRows) Columns() ([]string, error) {
+	columns := []string{}
+	err := r.fieldDescriptions(func(name string, oid uint32) {
+		columns = append(columns, name)
+	})
+	return columns, err
+}
+
+func (r pgxRows) ColumnTypeNames() ([]string, error) {
+	colTypNames := []string{}
+	err := r.fieldDescriptions(func(name string, oid uint32) {
+		colTypNames = append(colTypNames, pgTypeNames[oid])
+	})
+	return colTypNames, err
+}
+
+// calls fn with the name and type oid of every field description of pgx rows
+func (r pgxRows) fieldDescriptions(fn func(name string, oid uint32)) error {
+	method := reflect.ValueOf(r.PgxRowsSource).MethodByName("FieldDescriptions")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 || method.Type().Out(0).Kind() != reflect.Slice {
+		return fmt.Errorf("carta: %T does not have a FieldDescriptions() method", r.PgxRowsSource)
+	}
+	fields := method.Call(nil)[0]
+	for i := 0; i < fields.Len(); i++ {
+		field := reflect.Indirect(fields.Index(i))
+		if field.Kind() != reflect.Struct {
+			return fmt.Errorf("carta: unsupported field description %s", field.Type())
+		}
+		var (
+			name string
+			oid  uint32
+		)
+		// Name is a []byte in pgx v4 and a string in v5
+		switch n := field.FieldByName("Name"); {
+		case n.Kind() == reflect.String:
+			name = n.String()
+		case n.Kind() == reflect.Slice && n.Type().Elem().Kind() == reflect.Uint8:
+			name = string(n.Bytes())
+		default:
+			return fmt.Errorf("carta: field description %s does not have a Name", field.Type())
+		}
+		if o := field.FieldByName("DataTypeOID"); o.IsValid() && o.Kind() == reflect.Uint32 {
+			oid = uint32(o.Uint())
+		}
+		fn(name, oid)
+	}
+	return nil
+}
+
+// Type names of common postgres type oids, as returned by *sql.ColumnType.DatabaseTypeName when using lib/pq
+var pgTypeNames = map[uint32]string{
+	16:   "BOOL",
+	17:   "BYTEA",
+	18:   "CHAR",
+	20:   "INT8",
+	21:   "INT2",
+	23:   "INT4",
+	25:   "TEXT",
+	26:   "OID",
+	114:  "JSON",
+	142:  "XML",
+	650:  "CIDR",
+	700:  "FLOAT4",
+	701:  "FLOAT8",
+	869:  "INET",
+	1000: "_BOOL",
+	1001: "_BYTEA",
+	1005: "_INT2",
+	1007: "_INT4",
+	1009: "_TEXT",
+	1015: "_VARCHAR",
+	1016: "_INT8",
+	1021: "_FLOAT4",
+	1022: "_FLOAT8",
+	1042: "BPCHAR",
+	1043: "VARCHAR",
+	1082: "DATE",
+	1083: "TIME",
+	1114: "TIMESTAMP",
+	1115: "_TIMESTAMP",
+	1182: "_DATE",
+	1184: "TIMESTAMPTZ",
+	1185: "_TIMESTAMPTZ",
+	1186: "INTERVAL",
+	1266: "TIMETZ",
+	1560: "BIT",
+	1562: "VARBIT",
+	1700: "NUMERIC",
+	2950: "UUID",
+	2951: "_UUID",
+	3802: "JSONB",
+	3807: "_JSONB",
+}
@@ -0,0 +1,110 @@
+package carta
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+var errorTyp = reflect.TypeOf((*error)(nil)).Elem()
+
+// Stream maps rows onto the type accepted by fn and calls fn with every root object as soon as it is fully assembled,
+// fn must be a function of type func(T) error or func(*T) error.
+//
+// Unlike Map, only the current root object and its has-one and has-many relationships are held in memory.
+// A root object is considered complete once a row with a different root unique id arrives,
+// therefore your query must be ordered by the columns of the root struct, ie "order by blog_id".
+// Rows of a root which arrive out of order are handed to fn again as a separate object.
+//
+// Mapping stops at the first error returned by fn, that error is returned by Stream
+func Stream(rows *sql.Rows, fn interface{}, opts ...Option) error {
+	return StreamContext(context.Background(), rows, fn, opts...)
+}
+
+// StreamContext is like Stream, but stops mapping once ctx is done, see MapContext
+func StreamContext(ctx context.Context, rows *sql.Rows, fn interface{}, opts ...Option) error {
+	return StreamSourceContext(ctx, SQLRows(rows), fn, opts...)
+}
+
+// StreamSource is like Stream, but reads rows from any RowSource, ie pgx rows adapted with PgxRows
+func StreamSource(src RowSource, fn interface{}, opts ...Option) error {
+	return StreamSourceContext(context.Background(), src, fn, opts...)
+}
+
+// StreamSourceContext is like StreamSource, but stops mapping once ctx is done, see MapContext
+func StreamSourceContext(ctx context.Context, src RowSource, fn interface{}, opts ...Option) error {
+	var (
+		mapper *Mapper
+		err    error
+	)
+	defer src.Close()
+	fnVal := reflect.ValueOf(fn)
+	fnTyp := fnVal.Type()
+	if fnTyp.Kind() != reflect.Func || fnTyp.NumIn() != 1 || fnTyp.NumOut() != 1 || fnTyp.Out(0) != errorTyp {
+		return fmt.Errorf("carta: cannot stream rows onto %s, fn must be of type func(T) error or func(*T) error", fnTyp)
+	}
+	columns, err := src.Columns()
+	if err != nil {
+		return err
+	}
+	colTypNames, err := src.ColumnTypeNames()
+	if err != nil {
+		return err
+	}
+	sliceTyp := reflect.SliceOf(fnTyp.In(0))
+	o := newOptions(opts)
+	if mapper, err = mapperFor(columns, colTypNames, reflect.PtrTo(sliceTyp), o); err != nil {
+		return err
+	}
+
+	if mapper.tree != nil {
+		// nodes of a tree may arrive in any order, the tree is complete only after the last row
+		return fmt.Errorf("carta: tree %s cannot be streamed, use Map", mapper.path)
+	}
+
+	rowCount := 0
+
+	// emit sets the root held by the resolver and passes it to fn
+	emit := func(rsv *resolver) error {
+		dst := reflect.New(sliceTyp)
+		if err := setDst(ctx, mapper, dst, rsv); err != nil {
+			if ctx.Err() != nil {
+				return cancelled(ctx, rowCount)
+			}
+			return err
+		}
+		for i := 0; i < dst.Elem().Len(); i++ {
+			if out := fnVal.Call([]reflect.Value{dst.Elem().Index(i)}); !out[0].IsNil() {
+				return out[0].Interface().(error)
+			}
+		}
+		return nil
+	}
+
+	rsv := newResolver()
+	_, err = scanRows(ctx, src, colTypNames, o, func(row []interface{}) error {
+		if len(rsv.elementOrder) != 0 {
+			uid, _, err := elementUid(mapper, row)
+			if err != nil {
+				return err
+			}
+			if _, found := rsv.elements[uid]; !found || mapper.keyByRow {
+				// new root, previous one is complete
+				if err := emit(rsv); err != nil {
+					return err
+				}
+				rsv = newResolver()
+			}
+		}
+		rowCount++
+		return loadRow(mapper, row, rsv)
+	})
+	if err != nil {
+		return err
+	}
+	if len(rsv.elementOrder) != 0 {
+		return emit(rsv)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package carta
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Options of the db tag follow the column name and are separated by commas, ie `db:"blog_id,pk"`
+// Options can also carry a value, ie `db:"name,opt=value"`
+const (
+	// field is part of the identity of its struct, when present, only key fields are used to resolve unique objects
+	// multiple key fields make a composite key
+	pkOption = "pk"
+	// column is decoded as json into the field, which can then be of any type, ie a struct, map or slice
+	jsonOption = "json"
+	// has-one or has-many relationship is loaded from a single json column, ie json_agg(json_build_object(...))
+	jsonAggOption = "jsonagg"
+	// column is a postgres array, ie int[] or text[], parsed into the slice field
+	arrayOption = "array"
+	// field of a struct holds its key in a parent map, ie map[string]Setting,
+	// on a map field, "mapkey=column" names the column holding keys instead
+	mapKeyOption = "mapkey"
+	// names the discriminator column of a polymorphic field, ie `db:"payment,discriminator=payment_type"`, see RegisterVariant
+	discriminatorOption = "discriminator"
+	// field may have no column, even when mapping with WithStrict(StrictFields)
+	optionalOption = "optional"
+	// field is the identity of a node of a tree, loaded from an adjacency list, see findTree
+	treeKeyOption = "treekey"
+	// field holds the key of the parent node of a tree, null for roots
+	treeParentOption = "treeparent"
+	// elements of a basic collection, ie Tags []string, are keyed by the position of their row with "keyby=row",
+	// or by the value of a column with "keyby=column", rather than by their own value, therefore duplicate values are kept
+	keyByOption = "keyby"
+)
+
+type tagOptions map[string]string
+
+// fields with leaf options are loaded from a single column, regardless of their type
+func isLeafTag(opts tagOptions) bool {
+	return opts.has(jsonOption) || opts.has(jsonAggOption) || opts.has(arrayOption)
+}
+
+func parseTag(t reflect.StructTag) (string, tagOptions) {
+	parts := strings.Split(t.Get(CartaTagKey), ",")
+	opts := tagOptions{}
+	for _, opt := range parts[1:] {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		name, val, _ := strings.Cut(opt, "=")
+		opts[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	return strings.TrimSpace(parts[0]), opts
+}
+
+func (o tagOptions) has(opt string) bool {
+	_, ok := o[opt]
+	return ok
+}
+
+func (o tagOptions) get(opt string) string {
+	return o[opt]
+}
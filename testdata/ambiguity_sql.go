@@ -0,0 +1,17 @@
+package testdata
+
+// Lead and Members both match the name column
+type Team struct {
+	Id      int      `db:"id"`
+	Lead    Person   `db:"lead"`
+	Members []Person `db:"members"`
+}
+
+var AmbiguousQuery = `
+select 1 as id, 'ann' as name, 2 as members_id, 3 as lead_id
+`
+
+// lead_name is claimed by Lead, which leaves name to Members
+var PrefixedQuery = `
+select 1 as id, 'bob' as lead_name, 'ann' as name
+`
@@ -0,0 +1,30 @@
+package testdata
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ArrayTest struct {
+	Id     int              `db:"id"`
+	Ints   []int64          `db:"ints,array"`
+	Texts  []*string        `db:"texts,array"`
+	Grid   [][]float64      `db:"grid,array"`
+	Times  []time.Time      `db:"times,array"`
+	Flags  *[]bool          `db:"flags,array"`
+	Labels []sql.NullString `db:"labels,array"`
+}
+
+var ArrayQueryPG = `
+select
+	1                                                 as id,
+	cast ( '{1,2,3}'                    as bigint[] )           as ints,
+	cast ( '{"a b",NULL,"c\"d"}'        as text[] )             as texts,
+	cast ( '{{1.5,2},{3,4}}'            as double precision[] ) as grid,
+	cast ( '{"2004-10-19 10:23:54+02"}' as timestamptz[] )      as times,
+	cast ( '{t,f}'                      as boolean[] )          as flags,
+	cast ( '{x,NULL}'                   as varchar[] )          as labels
+union all
+select 2, '{}', null, null, null, null, null
+order by id
+`
@@ -0,0 +1,31 @@
+package testdata
+
+import (
+	"encoding/json"
+)
+
+type BytesTest struct {
+	Id    int             `db:"id" json:"id,omitempty"`
+	Data  []byte          `db:"data" json:"data,omitempty"`
+	Thumb *[]byte         `db:"thumb" json:"thumb,omitempty"`
+	Meta  json.RawMessage `db:"meta" json:"meta,omitempty"`
+	Hash  [4]byte         `db:"hash" json:"hash,omitempty"`
+}
+
+var BytesQueryPG = `
+select
+1                                 as "id",
+cast ( '\x00ff10' as bytea )      as "data",
+cast ( null as bytea )            as "thumb",
+cast ( '{"a": 1}' as bytea )      as "meta",
+cast ( '\xdeadbeef' as bytea )    as "hash"
+`
+
+var BytesQueryMySQL = `
+select
+1                                 as "id",
+X'00FF10'                         as "data",
+cast( null as binary )            as "thumb",
+cast( '{"a": 1}' as binary )      as "meta",
+X'DEADBEEF'                       as "hash"
+`
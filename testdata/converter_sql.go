@@ -0,0 +1,21 @@
+package testdata
+
+type Weekday int
+
+const (
+	Monday Weekday = iota + 1
+	Tuesday
+)
+
+type ConverterTest struct {
+	Id  int      `db:"id" json:"id,omitempty"`
+	Day Weekday  `db:"day" json:"day,omitempty"`
+	Off *Weekday `db:"off" json:"off,omitempty"`
+}
+
+var ConverterQuery = `
+select 1 as id, 'monday' as day, null as off
+union all
+select 2 as id, 'tuesday' as day, 'monday' as off
+order by id
+`
@@ -0,0 +1,27 @@
+package testdata
+
+type Person struct {
+	Id   int    `db:"id"`
+	Name string `db:"name"`
+	Note string `db:"note"`
+}
+
+type Audit struct {
+	CreatedBy string `db:"created_by"`
+}
+
+// Manager embeds Person, its fields are mapped as if they were declared on Manager
+type Manager struct {
+	Person
+	*Audit
+	Note    string   `db:"manager_note"` // shadows Person.Note
+	Reports []Person `db:"reports"`
+	Mentor  Person   `db:"mentor"`
+}
+
+var EmbeddedQuery = `
+select 1 as id, 'ann' as name, 'boss' as manager_note, 'root' as created_by, 2 as reports_id, 'bob' as reports_name, 'n' as reports_note, 3 as mentor_id, 'cid' as mentor_name, 'm' as mentor_note
+union all
+select 1 as id, 'ann' as name, 'boss' as manager_note, 'root' as created_by, 4 as reports_id, 'dan' as reports_name, 'n' as reports_note, 3 as mentor_id, 'cid' as mentor_name, 'm' as mentor_note
+order by reports_id
+`
@@ -0,0 +1,19 @@
+package testdata
+
+type Settings struct {
+	Theme string `json:"theme,omitempty"`
+}
+
+type JSONTest struct {
+	Id       int                    `db:"id" json:"id,omitempty"`
+	Settings Settings               `db:"settings,json" json:"settings,omitempty"`
+	Extra    map[string]interface{} `db:"extra,json" json:"extra,omitempty"`
+	Labels   *[]string              `db:"labels,json" json:"labels,omitempty"`
+}
+
+var JSONQuery = `
+select 1 as id, '{"theme": "dark"}' as settings, '{"beta": true}' as extra, '["a", "b"]' as labels
+union all
+select 2 as id, '{}' as settings, null as extra, null as labels
+order by id
+`
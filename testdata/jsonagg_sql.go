@@ -0,0 +1,29 @@
+package testdata
+
+type JSONAggBlog struct {
+	BlogId int           `db:"blog_id"`
+	Posts  []JSONAggPost `db:"posts,jsonagg"`
+	Latest *JSONAggPost  `db:"latest,jsonagg"`
+}
+
+type JSONAggPost struct {
+	PostId  int            `db:"post_id"`
+	Subject *string        `db:"post_subject"`
+	Author  *JSONAggAuthor `db:"author"`
+	Tags    []string       `db:"tags,jsonagg"`
+}
+
+type JSONAggAuthor struct {
+	AuthorId int    `db:"author_id"`
+	Username string `db:"username"`
+}
+
+// aggregated json is selected as text, the same query works for postgres' json_agg and mysql's JSON_ARRAYAGG
+var JSONAggQuery = `
+select 1 as blog_id,
+	'[{"post_id": 1, "post_subject": "first", "author": {"author_id": 7, "username": "ann"}, "tags": ["a", "b"]}, {"post_id": 2, "post_subject": null, "author": null, "tags": null}]' as posts,
+	'{"post_id": 2}' as latest
+union all
+select 2 as blog_id, '[null]' as posts, null as latest
+order by blog_id
+`
@@ -0,0 +1,19 @@
+package testdata
+
+type KeyByPost struct {
+	PostId   int      `db:"post_id,pk"`
+	Labels   []string `db:"label"`
+	Repeated []string `db:"repeated_label,keyby=row"`
+	Readings []int    `db:"reading,keyby=reading_seq"`
+	// the key column of readings is also mapped onto the post
+	ReadingSeq int `db:"reading_seq"`
+}
+
+// label "go" appears twice, as does the reading 5, the last row repeats the reading of sequence 2 because of a join
+var KeyByQuery = `
+select 1 as post_id, 'go' as label, 'go' as repeated_label, 5 as reading, 1 as reading_seq
+union all
+select 1 as post_id, 'go' as label, 'go' as repeated_label, 5 as reading, 2 as reading_seq
+union all
+select 1 as post_id, 'sql' as label, 'sql' as repeated_label, 5 as reading, 2 as reading_seq
+`
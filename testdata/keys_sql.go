@@ -0,0 +1,21 @@
+package testdata
+
+type KeyedBlog struct {
+	BlogId    int         `db:"blog_id,pk" json:"blog_id,omitempty"`
+	UpdatedAt string      `db:"updated_at" json:"updated_at,omitempty"`
+	Posts     []KeyedPost `db:"posts" json:"posts,omitempty"`
+}
+
+type KeyedPost struct {
+	PostId int `db:"post_id,pk" json:"post_id,omitempty"`
+}
+
+// updated_at differs between rows of the same blog
+var KeyedBlogQuery = `
+select 1 as blog_id, 'first' as updated_at, 1 as post_id
+union all
+select 1 as blog_id, 'second' as updated_at, 2 as post_id
+union all
+select 2 as blog_id, 'third' as updated_at, 3 as post_id
+order by blog_id, post_id
+`
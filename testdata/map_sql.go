@@ -0,0 +1,54 @@
+package testdata
+
+type MapUser struct {
+	UserId   int                   `db:"user_id"`
+	Settings map[string]MapSetting `db:"settings"`
+	Logins   map[int]*MapLogin     `db:"logins,mapkey=login_seq"`
+}
+
+type MapSetting struct {
+	Name  *string `db:"setting_name,mapkey"`
+	Value *string `db:"setting_value"`
+}
+
+// MapValueUser has a key field which is not a pointer
+type MapValueUser struct {
+	UserId   int                        `db:"user_id"`
+	Settings map[string]MapValueSetting `db:"settings"`
+}
+
+type MapValueSetting struct {
+	Name  string `db:"setting_name,mapkey"`
+	Value string `db:"setting_value"`
+}
+
+// MapIntKeyUser has an int key field, which cannot key a map of strings
+type MapIntKeyUser struct {
+	UserId int                       `db:"user_id"`
+	Logins map[string]MapIntKeyLogin `db:"logins"`
+}
+
+type MapIntKeyLogin struct {
+	Seq int     `db:"login_seq,mapkey"`
+	Ip  *string `db:"ip"`
+}
+
+type MapLogin struct {
+	Ip *string `db:"ip"`
+}
+
+var MapQuery = `
+select 1 as user_id, 'theme' as setting_name, 'dark' as setting_value, 1 as login_seq, '10.0.0.1' as ip
+union all
+select 1 as user_id, 'lang' as setting_name, 'en' as setting_value, 2 as login_seq, '10.0.0.1' as ip
+union all
+select 2 as user_id, null as setting_name, null as setting_value, null as login_seq, null as ip
+order by user_id
+`
+
+// theme has two distinct values
+var MapDuplicateKeyQuery = `
+select 1 as user_id, 'theme' as setting_name, 'dark' as setting_value, 1 as login_seq, '10.0.0.1' as ip
+union all
+select 1 as user_id, 'theme' as setting_name, 'light' as setting_value, 1 as login_seq, '10.0.0.1' as ip
+`
@@ -0,0 +1,34 @@
+package testdata
+
+type IntoBlog struct {
+	BlogId int        `db:"blog_id,pk"`
+	Title  string     `db:"title"`
+	Posts  []IntoPost `db:"posts"`
+}
+
+type IntoPost struct {
+	PostId  int    `db:"post_id"`
+	BlogId  int    `db:"blog_id"`
+	Subject string `db:"subject"`
+}
+
+var IntoBlogQuery = `
+select 1 as blog_id, 'first' as title
+union all
+select 2 as blog_id, 'second' as title
+union all
+select 3 as blog_id, 'third' as title
+order by blog_id
+`
+
+// posts of blogs 1 and 2, blog 9 was not mapped
+var IntoPostQuery = `
+select 1 as post_id, 1 as blog_id, 'hello' as subject
+union all
+select 2 as post_id, 2 as blog_id, 'again' as subject
+union all
+select 3 as post_id, 1 as blog_id, 'world' as subject
+union all
+select 4 as post_id, 9 as blog_id, 'orphan' as subject
+order by post_id
+`
@@ -0,0 +1,24 @@
+package testdata
+
+type NamingBlog struct {
+	BlogId int          `db:"blog_id"`
+	Writer NamingAuthor `db:"writer"`
+}
+
+type NamingAuthor struct {
+	AuthorId int    `db:"author_id"`
+	Username string `db:"username"`
+}
+
+// identifiers are quoted, postgres folds unquoted identifiers to lower case
+var CamelCaseQueryPG = `
+select 1 as "blogId", 2 as "writerAuthorId", 'ann' as "writerUsername"
+`
+
+var UpperCaseQueryPG = `
+select 1 as "BLOG_ID", 2 as "WRITER__AUTHOR_ID", 'ann' as "WRITER__USERNAME"
+`
+
+var ExactQueryPG = `
+select 1 as "blog_id", 2 as "writer_author_id", 'ann' as "WRITER_USERNAME"
+`
@@ -0,0 +1,64 @@
+package testdata
+
+import (
+	"database/sql"
+)
+
+// field descriptions of pgx v4, ie pgproto3.FieldDescription
+type PgxFieldV4 struct {
+	Name        []byte
+	DataTypeOID uint32
+}
+
+// field descriptions of pgx v5, ie pgconn.FieldDescription
+type PgxFieldV5 struct {
+	Name        string
+	DataTypeOID uint32
+}
+
+// PgxRows fakes the rows returned by pgx, without depending on pgx
+type PgxRows struct {
+	Values [][]interface{}
+	Closed bool
+	row    int
+}
+
+func (r *PgxRows) Next() bool {
+	r.row++
+	return r.row <= len(r.Values)
+}
+
+func (r *PgxRows) Scan(dest ...interface{}) error {
+	for i, v := range r.Values[r.row-1] {
+		if err := dest[i].(sql.Scanner).Scan(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PgxRows) Err() error { return nil }
+func (r *PgxRows) Close()     { r.Closed = true }
+
+type PgxRowsV4 struct {
+	*PgxRows
+	Fields []PgxFieldV4
+}
+
+func (r PgxRowsV4) FieldDescriptions() []PgxFieldV4 { return r.Fields }
+
+type PgxRowsV5 struct {
+	*PgxRows
+	Fields []PgxFieldV5
+}
+
+func (r PgxRowsV5) FieldDescriptions() []PgxFieldV5 { return r.Fields }
+
+type PgxBlog struct {
+	BlogId int    `db:"blog_id"`
+	Title  string `db:"title"`
+}
+
+func NewPgxValues() [][]interface{} {
+	return [][]interface{}{{int64(1), "first"}, {int64(2), "second"}}
+}
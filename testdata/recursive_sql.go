@@ -0,0 +1,17 @@
+package testdata
+
+type Category struct {
+	CategoryId int        `db:"category_id"`
+	Name       string     `db:"name"`
+	Children   []Category `db:"children"`
+}
+
+// two levels of categories, the third level of the depth limit has no columns
+var RecursiveQuery = `
+select 1 as category_id, 'books' as name, 2 as children_category_id, 'fiction' as children_name
+union all
+select 1 as category_id, 'books' as name, 3 as children_category_id, 'poetry' as children_name
+union all
+select 4 as category_id, 'music' as name, null as children_category_id, null as children_name
+order by category_id, children_category_id
+`
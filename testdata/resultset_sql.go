@@ -0,0 +1,17 @@
+package testdata
+
+type ResultSetBlog struct {
+	BlogId int    `db:"blog_id"`
+	Title  string `db:"title"`
+}
+
+type ResultSetAuthor struct {
+	AuthorId int    `db:"author_id"`
+	Name     string `db:"name"`
+}
+
+// two result sets of a batch of queries
+var ResultSetsQuery = `
+select 1 as blog_id, 'first' as title union all select 2 as blog_id, 'second' as title;
+select 1 as author_id, 'ann' as name;
+`
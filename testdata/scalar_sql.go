@@ -0,0 +1,23 @@
+package testdata
+
+var ScalarQuery = `
+select 1 as n
+union all
+select 2 as n
+union all
+select 1 as n
+`
+
+var ScalarColumnQuery = `
+select 1 as id, 'first' as title
+`
+
+var ScalarBytesQuery = `
+select 'ab' as b
+union all
+select 'cd' as b
+`
+
+var ScalarNullQuery = `
+select cast(null as char(1)) as n
+`
@@ -0,0 +1,39 @@
+package testdata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cents implements sql.Scanner, parsing decimal text such as "12.50"
+type Cents int64
+
+func (c *Cents) Scan(src interface{}) error {
+	var text string
+	switch s := src.(type) {
+	case string:
+		text = s
+	case []byte:
+		text = string(s)
+	default:
+		return fmt.Errorf("cannot scan %T into Cents", src)
+	}
+	units, fraction, _ := strings.Cut(text, ".")
+	n, err := strconv.ParseInt(units+(fraction + "00")[:2], 10, 64)
+	*c = Cents(n)
+	return err
+}
+
+type ScannerTest struct {
+	Id     int    `db:"id" json:"id,omitempty"`
+	Amount Cents  `db:"amount" json:"amount,omitempty"`
+	Refund *Cents `db:"refund" json:"refund,omitempty"`
+}
+
+var ScannerQuery = `
+select 1 as id, '12.50' as amount, null as refund
+union all
+select 2 as id, '3' as amount, '0.5' as refund
+order by id
+`
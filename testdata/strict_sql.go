@@ -0,0 +1,27 @@
+package testdata
+
+type StrictBlog struct {
+	BlogId int          `db:"blog_id"`
+	Title  string       `db:"title"`
+	Posts  []StrictPost `db:"posts"`
+}
+
+type StrictPost struct {
+	PostId  int    `db:"post_id"`
+	Subject string `db:"subject"`
+	Draft   *bool  `db:"draft,optional"`
+}
+
+var StrictQuery = `
+select 1 as blog_id, 'first' as title, 1 as post_id, 'hello' as subject
+`
+
+// title and subject are misspelled
+var StrictTypoQuery = `
+select 1 as blog_id, 'first' as titel, 1 as post_id, 'hello' as subjcet
+`
+
+// subject of the post is aliased twice, posts_subject is the better match
+var StrictShadowedQuery = `
+select 1 as blog_id, 'first' as title, 1 as post_id, 'hello' as subject, 'hi' as posts_subject
+`
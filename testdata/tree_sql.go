@@ -0,0 +1,45 @@
+package testdata
+
+type TreeCategory struct {
+	CategoryId int            `db:"category_id,treekey"`
+	ParentId   *int           `db:"parent_id,treeparent"`
+	Name       string         `db:"name"`
+	Children   []TreeCategory `db:"children"`
+}
+
+// rows of an adjacency list, as returned by a recursive CTE
+var TreeQuery = `
+select 1 as category_id, null as parent_id, 'books' as name
+union all
+select 2 as category_id, 1 as parent_id, 'fiction' as name
+union all
+select 3 as category_id, 2 as parent_id, 'crime' as name
+union all
+select 4 as category_id, null as parent_id, 'music' as name
+union all
+select 5 as category_id, 1 as parent_id, 'poetry' as name
+order by category_id
+`
+
+// parent 9 is not returned
+var TreeOrphanQuery = `
+select 1 as category_id, null as parent_id, 'books' as name
+union all
+select 2 as category_id, 9 as parent_id, 'fiction' as name
+`
+
+// categories 2 and 3 are each others parent
+var TreeCycleQuery = `
+select 1 as category_id, null as parent_id, 'books' as name
+union all
+select 2 as category_id, 3 as parent_id, 'fiction' as name
+union all
+select 3 as category_id, 2 as parent_id, 'crime' as name
+`
+
+// parents arrive as text, keys as integers
+var TreeTextParentQuery = `
+select 1 as category_id, null as parent_id, 'books' as name
+union all
+select 2 as category_id, cast(1 as char(1)) as parent_id, 'fiction' as name
+`
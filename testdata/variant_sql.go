@@ -0,0 +1,39 @@
+package testdata
+
+import "github.com/jackskj/carta"
+
+type PaymentMethod interface {
+	Label() string
+}
+
+type Card struct {
+	Number string `db:"number"`
+}
+
+func (c Card) Label() string { return "card " + c.Number }
+
+type BankAccount struct {
+	Iban string `db:"iban"`
+}
+
+func (b *BankAccount) Label() string { return "bank " + b.Iban }
+
+type Customer struct {
+	CustomerId int             `db:"customer_id,pk"`
+	Methods    []PaymentMethod `db:"methods"`
+	Primary    PaymentMethod   `db:"primary,discriminator=primary_type"`
+}
+
+func init() {
+	carta.RegisterVariant((*PaymentMethod)(nil), "card", Card{})
+	carta.RegisterVariant((*PaymentMethod)(nil), "bank", &BankAccount{})
+}
+
+var VariantQuery = `
+select 1 as customer_id, 'card' as methods_kind, '4242' as number, null as iban, 'bank' as primary_type, 'DE89' as primary_iban
+union all
+select 1 as customer_id, 'bank' as methods_kind, null as number, 'DE89' as iban, 'bank' as primary_type, 'DE89' as primary_iban
+union all
+select 2 as customer_id, null as methods_kind, null as number, null as iban, null as primary_type, null as primary_iban
+order by customer_id
+`
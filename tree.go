@@ -0,0 +1,198 @@
+package carta
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Trees are loaded from flat rows of an adjacency list, such as rows of a recursive CTE.
+// The struct marks the identity of a node with the "treekey" tag option, the key of its parent with the "treeparent" option,
+// and holds its children in a slice of itself, ie
+//
+//	type Category struct {
+//		CategoryId int        `db:"category_id,treekey"`
+//		ParentId   *int       `db:"parent_id,treeparent"`
+//		Children   []Category
+//	}
+//
+// Once loaded, every node is appended to the children of its parent, in the order of rows, and only roots,
+// nodes with a null parent, are returned. Parents which are not found, as well as cycles, are an error.
+
+// tree holds the fields of a struct which is loaded as a tree
+type tree struct {
+	key      fieldIndex // field of the "treekey" option, also a key field of the struct
+	parent   fieldIndex // field of the "treeparent" option
+	children fieldIndex // slice of the struct itself
+}
+
+// findTree returns the tree fields of the struct, nil if the struct declares neither a "treekey" nor a "treeparent" field
+func findTree(t reflect.Type, fields []reflect.StructField) (*tree, error) {
+	var (
+		keys, parents, children []fieldIndex
+	)
+	for i, field := range fields {
+		_, opts := parseTag(field.Tag)
+		if opts.has(treeKeyOption) {
+			keys = append(keys, fieldIndex(i))
+		}
+		if opts.has(treeParentOption) {
+			parents = append(parents, fieldIndex(i))
+		}
+		if isExported(field) && isTreeChildren(t, field.Type) {
+			children = append(children, fieldIndex(i))
+		}
+	}
+	if len(keys) == 0 && len(parents) == 0 {
+		return nil, nil
+	}
+	if len(keys) != 1 || len(parents) != 1 {
+		return nil, fmt.Errorf("carta: tree %s must have exactly one treekey and one treeparent field", t)
+	}
+	if len(children) != 1 {
+		return nil, fmt.Errorf("carta: tree %s must have exactly one field of type []%s or []*%s holding its children", t, t, t)
+	}
+	for _, i := range []fieldIndex{keys[0], parents[0]} {
+		if !isComparableKey(fields[i].Type) {
+			return nil, fmt.Errorf("carta: tree field %s.%s of type %s cannot be compared", t, fields[i].Name, fields[i].Type)
+		}
+	}
+	return &tree{key: keys[0], parent: parents[0], children: children[0]}, nil
+}
+
+// test whether the type is a slice of t, pointers to t, or a pointer to such slice
+func isTreeChildren(t reflect.Type, fieldTyp reflect.Type) bool {
+	if fieldTyp.Kind() == reflect.Ptr {
+		fieldTyp = fieldTyp.Elem()
+	}
+	if fieldTyp.Kind() != reflect.Slice {
+		return false
+	}
+	elem := fieldTyp.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem == t
+}
+
+// allocateTreeColumns checks that the key and parent fields have columns
+func allocateTreeColumns(m *Mapper) error {
+	claimed := map[fieldIndex]bool{}
+	for _, c := range m.PresentColumns {
+		claimed[c.i] = true
+	}
+	if !claimed[m.tree.key] {
+		return fmt.Errorf("carta: treekey column of %s not found", m.fieldPath(m.tree.key))
+	}
+	if !claimed[m.tree.parent] {
+		return fmt.Errorf("carta: treeparent column of %s not found", m.fieldPath(m.tree.parent))
+	}
+	return nil
+}
+
+// treeKeys returns the keys of a loaded node and of its parent, the parent key is nil for roots.
+// Keys are the values of the fields rather than of the columns, therefore a key and a parent are matched
+// regardless of the types they arrive in from the database, ie int64 and text
+func (m *Mapper) treeKeys(node reflect.Value) (interface{}, interface{}, error) {
+	key, err := treeKeyValue(m.field(node, m.tree.key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("carta: cannot compare treekey field %s: %w", m.fieldPath(m.tree.key), err)
+	}
+	parent, err := treeKeyValue(m.field(node, m.tree.parent))
+	if err != nil {
+		return nil, nil, fmt.Errorf("carta: cannot compare treeparent field %s: %w", m.fieldPath(m.tree.parent), err)
+	}
+	return key, parent, nil
+}
+
+// treeKeyValue returns the comparable value of the key or parent field of a node, see keyValue,
+// numbers and strings are normalized, since both fields may be declared with different types, ie int and *int64
+func treeKeyValue(field reflect.Value) (interface{}, error) {
+	v, err := keyValue(field)
+	if v == nil || err != nil {
+		return v, err
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	}
+	return v, nil
+}
+
+// linkTree appends every element of the resolver to the children of its parent, and returns the ids of roots in order
+func linkTree(m *Mapper, rsv *resolver) ([]uniqueValId, error) {
+	byKey := make(map[interface{}]*element, len(rsv.elements))
+	for _, uid := range rsv.elementOrder {
+		elem := rsv.elements[uid]
+		byKey[elem.treeKey] = elem
+	}
+	roots := []uniqueValId{}
+	children := map[*element][]*element{}
+	for _, uid := range rsv.elementOrder {
+		elem := rsv.elements[uid]
+		if elem.treeParent == nil {
+			roots = append(roots, uid)
+			continue
+		}
+		parent, ok := byKey[elem.treeParent]
+		if !ok {
+			return nil, fmt.Errorf("carta: parent of %s %v not found", m.path, m.treeKeyOf(elem))
+		}
+		children[parent] = append(children[parent], elem)
+	}
+
+	linked := make(map[*element]bool, len(rsv.elements))
+	// children are linked before their parent, since elements of []T are copied when appended
+	var link func(elem *element)
+	link = func(elem *element) {
+		linked[elem] = true
+		for _, child := range children[elem] {
+			link(child)
+			appendChild(m, elem, child)
+		}
+	}
+	for _, uid := range roots {
+		link(rsv.elements[uid])
+	}
+	for _, uid := range rsv.elementOrder {
+		// every element which is not an orphan, but cannot be reached from a root, is part of a cycle
+		if elem := rsv.elements[uid]; !linked[elem] {
+			return nil, fmt.Errorf("carta: %s %v is part of a cycle", m.path, m.treeKeyOf(elem))
+		}
+	}
+	return roots, nil
+}
+
+func appendChild(m *Mapper, parent *element, child *element) {
+	children := m.field(parent.v, m.tree.children)
+	if children.Kind() == reflect.Ptr {
+		if children.IsNil() {
+			children.Set(reflect.New(children.Type().Elem()))
+		}
+		children = children.Elem()
+	}
+	v := child.v
+	if children.Type().Elem().Kind() == reflect.Ptr {
+		v = child.v.Addr()
+	}
+	children.Set(reflect.Append(children, v))
+}
+
+// treeKeyOf returns the value of the key field of the element, used in errors
+func (m *Mapper) treeKeyOf(elem *element) interface{} {
+	key := reflect.Indirect(m.field(elem.v, m.tree.key))
+	if !key.IsValid() {
+		return nil
+	}
+	return key.Interface()
+}
@@ -0,0 +1,155 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseArray parses a postgres array literal, ie {1,2,3}, {"a b",NULL,"c\"d"} or {{1,2},{3,4}}
+// Elements of the returned slice are strings, nil for NULL elements, or []interface{} for nested dimensions.
+// An optional dimension decoration, ie [0:2]={1,2,3}, is ignored
+func ParseArray(text string) ([]interface{}, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "[") {
+		if i := strings.Index(text, "="); i != -1 {
+			text = strings.TrimSpace(text[i+1:])
+		}
+	}
+	p := arrayParser{text: text}
+	elems, err := p.parseArray()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.text) {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	return elems, nil
+}
+
+// ArrayElemTypeName returns the database type name of elements of an array column,
+// postgres drivers prefix type names of arrays with an underscore, ie _INT4 or _TIMESTAMPTZ
+func ArrayElemTypeName(colTypName string) string {
+	return strings.TrimPrefix(colTypName, "_")
+}
+
+type arrayParser struct {
+	text string
+	pos  int
+}
+
+func (p *arrayParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid array literal %q at position %d: %s", p.text, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *arrayParser) skipSpace() {
+	for p.pos < len(p.text) && isArraySpace(p.text[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *arrayParser) parseArray() ([]interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) || p.text[p.pos] != '{' {
+		return nil, p.errorf("expected '{'")
+	}
+	p.pos++
+	elems := []interface{}{}
+	p.skipSpace()
+	if p.pos < len(p.text) && p.text[p.pos] == '}' {
+		p.pos++
+		return elems, nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.text) {
+			return nil, p.errorf("unterminated array")
+		}
+		var (
+			elem interface{}
+			err  error
+		)
+		switch p.text[p.pos] {
+		case '{':
+			elem, err = p.parseArray()
+		case '"':
+			elem, err = p.parseQuoted()
+		default:
+			elem, err = p.parseUnquoted()
+		}
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		p.skipSpace()
+		if p.pos >= len(p.text) {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.text[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return elems, nil
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (p *arrayParser) parseQuoted() (interface{}, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		switch c {
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.text) {
+				return nil, p.errorf("unterminated escape")
+			}
+			b.WriteByte(p.text[p.pos])
+		case '"':
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+		p.pos++
+	}
+	return nil, p.errorf("unterminated quoted element")
+}
+
+func (p *arrayParser) parseUnquoted() (interface{}, error) {
+	var b strings.Builder
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if c == ',' || c == '}' {
+			break
+		}
+		if c == '{' || c == '"' {
+			return nil, p.errorf("unexpected %q", c)
+		}
+		if c == '\\' {
+			p.pos++
+			if p.pos >= len(p.text) {
+				return nil, p.errorf("unterminated escape")
+			}
+			c = p.text[p.pos]
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	elem := strings.TrimRightFunc(b.String(), func(r rune) bool { return r < 128 && isArraySpace(byte(r)) })
+	if elem == "" {
+		return nil, p.errorf("empty element")
+	}
+	if strings.EqualFold(elem, "NULL") {
+		return nil, nil
+	}
+	return elem, nil
+}
+
+func isArraySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
@@ -0,0 +1,33 @@
+package value
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArray(t *testing.T) {
+	cases := []struct {
+		text string
+		want []interface{}
+	}{
+		{`{}`, []interface{}{}},
+		{`{1,2,3}`, []interface{}{"1", "2", "3"}},
+		{`{"a b",NULL,null,"NULL","c\"d\\e", plain }`, []interface{}{"a b", nil, nil, "NULL", `c"d\e`, "plain"}},
+		{`{{1,2},{3,4}}`, []interface{}{[]interface{}{"1", "2"}, []interface{}{"3", "4"}}},
+		{`[1:1][0:1]={{1,2}}`, []interface{}{[]interface{}{"1", "2"}}},
+		{`{"2004-10-19 10:23:54+02"}`, []interface{}{"2004-10-19 10:23:54+02"}},
+	}
+	for _, tc := range cases {
+		got, err := ParseArray(tc.text)
+		if err != nil {
+			t.Errorf("%q: %s", tc.text, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %#v, want %#v", tc.text, got, tc.want)
+		}
+	}
+	for _, text := range []string{``, `1,2`, `{1,2`, `{1,,2}`, `{"a"b}`, `{"a}`, `{1}2`} {
+		if _, err := ParseArray(text); err == nil {
+			t.Errorf("%q: expected error", text)
+		}
+	}
+}
@@ -2,9 +2,9 @@ package value
 
 import (
 	"database/sql"
-	"errors"
+	"database/sql/driver"
+	"encoding/binary"
 	"fmt"
-	"log"
 	"math"
 	"reflect"
 	"strconv"
@@ -14,15 +14,15 @@ import (
 	"github.com/golang/protobuf/ptypes/timestamp"
 )
 
-// TODO:  timestamp/time/ from string
 // TODO:  int/float/uint/bool from string
 
 type Cell struct {
 	kind       reflect.Kind // data type with which Cell will be instantiated
 	bits       uint64       //IEEE 754 binary representation of numeric value
-	text       string       // non-numeric data as bytes for data which arrives as string or []byte
+	text       string       // non-numeric data for data which arrives as string or []byte, kind tells which one it was
 	time       time.Time    //  any data that arrives as time, that includes timestame w/ or w/o zone
 	colTypName string       // Used for parting if some data arrices in plain text format, ex, if time arrives as string
+	timeParser *TimeParser  // parses time which arrives as text, the default layouts are used if nil
 	valid      bool
 }
 
@@ -38,6 +38,16 @@ func NewCell(colTypName string) *Cell {
 	return &Cell{colTypName: colTypName}
 }
 
+// NewCellWithTimeParser is like NewCell, but time which arrives as text is parsed with p
+func NewCellWithTimeParser(colTypName string, p *TimeParser) *Cell {
+	return &Cell{colTypName: colTypName, timeParser: p}
+}
+
+// TimeParser returns the parser of time which arrives as text, nil if the default layouts are used
+func (c Cell) TimeParser() *TimeParser {
+	return c.timeParser
+}
+
 // implements database/sql scan interface
 func (c *Cell) Scan(src interface{}) error {
 	switch src.(type) {
@@ -48,7 +58,7 @@ func (c *Cell) Scan(src interface{}) error {
 	case bool:
 		c.SetBool(src.(bool))
 	case []byte:
-		c.SetString(string(src.([]byte)))
+		c.SetBytes(src.([]byte))
 	case string:
 		c.SetString(src.(string))
 	case time.Time:
@@ -77,7 +87,7 @@ func (c *Cell) SetFloat64(d float64) {
 }
 
 func (c *Cell) SetInt64(d int64) {
-	c.kind = reflect.Float64
+	c.kind = reflect.Int64
 	c.valid = true
 	c.bits = uint64(d)
 }
@@ -88,6 +98,13 @@ func (c *Cell) SetString(d string) {
 	c.text = d
 }
 
+// SetBytes copies d, the sql driver may reuse it for the next row
+func (c *Cell) SetBytes(d []byte) {
+	c.kind = reflect.Slice
+	c.valid = true
+	c.text = string(d)
+}
+
 func (c *Cell) SetTime(d time.Time) {
 	c.kind = reflect.Struct
 	c.valid = true
@@ -110,73 +127,103 @@ func (c Cell) IsValid() bool {
 	return c.valid
 }
 
+// TypeName returns the database type name of the column the cell was scanned from
+func (c Cell) TypeName() string {
+	return c.colTypName
+}
+
+// data arrived as string or []byte
+func (c Cell) isText() bool {
+	return c.kind == reflect.String || c.kind == reflect.Slice
+}
+
 func (c Cell) Bool() (bool, error) {
+	if c.isText() {
+		// postgres sends booleans as text as "t" or "f"
+		return strconv.ParseBool(c.text)
+	}
 	return (c.bits != 0), nil
 }
 
 func (c Cell) Int32() (int32, error) {
-	if c.kind == reflect.String {
+	if c.isText() {
 		if num, err := strconv.ParseInt(c.text, 10, 32); err != nil {
 			return 0, err
 		} else {
 			return int32(num), nil
 		}
 	}
+	if c.kind == reflect.Float64 {
+		return int32(math.Float64frombits(c.bits)), nil
+	}
 	return int32(c.bits), nil
 }
 
 func (c Cell) Int64() (int64, error) {
-	if c.kind == reflect.String {
+	if c.isText() {
 		if num, err := strconv.ParseInt(c.text, 10, 64); err != nil {
 			return 0, err
 		} else {
 			return int64(num), nil
 		}
 	}
+	if c.kind == reflect.Float64 {
+		return int64(math.Float64frombits(c.bits)), nil
+	}
 	return int64(c.bits), nil
 }
 
 func (c Cell) Uint32() (uint32, error) {
-	if c.kind == reflect.String {
+	if c.isText() {
 		if num, err := strconv.ParseUint(c.text, 10, 32); err != nil {
 			return 0, err
 		} else {
 			return uint32(num), nil
 		}
 	}
+	if c.kind == reflect.Float64 {
+		return uint32(math.Float64frombits(c.bits)), nil
+	}
 	return uint32(c.bits), nil
 }
 
 func (c Cell) Uint64() (uint64, error) {
-	if c.kind == reflect.String {
+	if c.isText() {
 		if num, err := strconv.ParseUint(c.text, 10, 64); err != nil {
 			return 0, err
 		} else {
 			return uint64(num), nil
 		}
 	}
+	if c.kind == reflect.Float64 {
+		return uint64(math.Float64frombits(c.bits)), nil
+	}
 	return c.bits, nil
 }
 
 func (c Cell) Float32() (float32, error) {
-	if c.kind == reflect.String {
+	if c.isText() {
 		if num, err := strconv.ParseFloat(c.text, 32); err != nil {
 			return 0, err
 		} else {
 			return float32(num), nil
 		}
 	}
-	return math.Float32frombits(uint32(c.bits)), nil
+	f, err := c.Float64()
+	return float32(f), err
 }
 
 func (c Cell) Float64() (float64, error) {
-	if c.kind == reflect.String {
+	if c.isText() {
 		if num, err := strconv.ParseFloat(c.text, 64); err != nil {
 			return 0, err
 		} else {
 			return num, nil
 		}
 	}
+	if c.kind == reflect.Int64 {
+		return float64(int64(c.bits)), nil
+	}
 	return math.Float64frombits(c.bits), nil
 }
 
@@ -184,28 +231,42 @@ func (c Cell) String() (string, error) {
 	return c.text, nil
 }
 
+// Bytes returns a copy of binary data, data must have arrived as []byte or string
+func (c Cell) Bytes() ([]byte, error) {
+	if !c.isText() {
+		return nil, fmt.Errorf("cannot convert %s data to []byte", c.kind)
+	}
+	return []byte(c.text), nil
+}
+
+// Time returns the time value of the cell,
+// time which arrived as text is parsed with the layouts of the column database type name, see TimeParser
 func (c Cell) Time() (time.Time, error) {
-	if c.kind == reflect.String {
-		// TODO: Parse from string
-		// switch c.colTypName {
-		// }
-		log.Println(c.text, " >aslkdfjaslkfj")
-		return time.Time{}, errors.New("cannot convert time data which arrived as string or []uint8 from sql")
+	if c.isText() {
+		if c.timeParser != nil {
+			return c.timeParser.Parse(c.colTypName, c.text)
+		}
+		return ParseTime(c.colTypName, c.text)
 	}
 	return c.time, nil
 }
 
 func (c Cell) Timestamp() (timestamp.Timestamp, error) {
-	var t time.Time
-	var err error
-	if t, err = c.Time(); err != nil {
+	ts, err := c.TimestampProto()
+	if err != nil {
 		return timestamp.Timestamp{}, err
 	}
-	if ts, err := ptypes.TimestampProto(t); err != nil {
-		return timestamp.Timestamp{}, err
-	} else {
-		return *ts, nil
+	// fields are copied into a new message, since messages hold a lock and must not be copied
+	return timestamp.Timestamp{Seconds: ts.Seconds, Nanos: ts.Nanos}, nil
+}
+
+// TimestampProto is like Timestamp, but returns a pointer to the message
+func (c Cell) TimestampProto() (*timestamp.Timestamp, error) {
+	t, err := c.Time()
+	if err != nil {
+		return nil, err
 	}
+	return ptypes.TimestampProto(t)
 }
 
 func (c Cell) NullBool() (sql.NullBool, error) {
@@ -274,6 +335,29 @@ func (c Cell) NullTime() (sql.NullTime, error) {
 	}, err
 }
 
+// Value returns the value of the cell in the form it arrived from the sql driver, implements driver.Valuer
+// the value is one of int64, float64, bool, []byte, string, time.Time or nil
+func (c Cell) Value() (driver.Value, error) {
+	if !c.valid {
+		return nil, nil
+	}
+	switch c.kind {
+	case reflect.Bool:
+		return c.bits != 0, nil
+	case reflect.Int64:
+		return int64(c.bits), nil
+	case reflect.Float64:
+		return math.Float64frombits(c.bits), nil
+	case reflect.String:
+		return c.text, nil
+	case reflect.Slice:
+		return []byte(c.text), nil
+	case reflect.Struct:
+		return c.time, nil
+	}
+	return nil, fmt.Errorf("carta: unknown kind of cell %s", c.kind)
+}
+
 func (c Cell) AsInterface() (interface{}, error) {
 	var i interface{}
 	var err error
@@ -294,31 +378,55 @@ func (c Cell) AsInterface() (interface{}, error) {
 		i, err = c.Float64()
 	case reflect.String:
 		i, err = c.String()
+	case reflect.Slice:
+		i, err = c.Bytes()
 	}
 	return i, err
 }
 
+// Uid encodes the kind and value of the cell,
+// encodings are self delimiting, therefore concatenated encodings of two distinct sequences of cells never collide
+// null, bool, int, float, string, []byte and time values are kept apart, time values keep nanosecond precision
 func (c Cell) Uid() string {
+	return string(c.AppendUid(nil))
+}
+
+// AppendUid appends the Uid of the cell to b
+func (c Cell) AppendUid(b []byte) []byte {
 	if c.IsNull() {
-		//TODO: safely represent null and bool values as string
-		return "cnull"
-	} else {
-		switch c.kind {
-		case reflect.Int64, reflect.Float64:
-			return strconv.FormatUint(c.bits, 36)
-		case reflect.String:
-			return c.text
-		case reflect.Bool:
-			if c.bits != 0 {
-				return "ctrue"
-			} else {
-				return "cfalse"
-			}
-		case reflect.Struct:
-			return strconv.FormatInt(c.time.Unix(), 36)
+		return append(b, 'n')
+	}
+	switch c.kind {
+	case reflect.Bool:
+		if c.bits != 0 {
+			return append(b, 'b', 1)
 		}
+		return append(b, 'b', 0)
+	case reflect.Int64:
+		return appendUint64(append(b, 'i'), c.bits)
+	case reflect.Float64:
+		return appendUint64(append(b, 'f'), c.bits)
+	case reflect.String, reflect.Slice:
+		var length [binary.MaxVarintLen64]byte
+		if c.kind == reflect.String {
+			b = append(b, 's')
+		} else {
+			b = append(b, 'y')
+		}
+		b = append(b, length[:binary.PutUvarint(length[:], uint64(len(c.text)))]...)
+		return append(b, c.text...)
+	case reflect.Struct:
+		// same instants in different locations are the same value
+		b = appendUint64(append(b, 't'), uint64(c.time.Unix()))
+		return appendUint64(b, uint64(c.time.Nanosecond()))
 	}
-	return ""
+	return append(b, 'x')
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
 }
 
 // func (c Cell) BitsAsString() string {
@@ -0,0 +1,137 @@
+package value
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// values are drawn from small domains, so that equal and similar looking tuples are generated often
+func randomCell(r *rand.Rand) Cell {
+	c := Cell{}
+	switch r.Intn(7) {
+	case 0:
+		c.SetNull()
+	case 1:
+		c.SetBool(r.Intn(2) == 0)
+	case 2:
+		c.SetInt64(int64(r.Intn(20) - 10))
+	case 3:
+		c.SetFloat64(float64(r.Intn(20)-10) / 2)
+	case 4:
+		text := strings.Builder{}
+		for i := r.Intn(5); i > 0; i-- {
+			text.WriteByte("12nulc"[r.Intn(6)])
+		}
+		c.SetString(text.String())
+	case 5:
+		c.SetTime(time.Unix(int64(r.Intn(3)), int64(r.Intn(3))))
+	case 6:
+		c.SetBytes([]byte{byte(r.Intn(2)), 'n'}[:r.Intn(3)])
+	}
+	return c
+}
+
+func randomTuple(r *rand.Rand) []Cell {
+	tuple := make([]Cell, r.Intn(4))
+	for i := range tuple {
+		tuple[i] = randomCell(r)
+	}
+	return tuple
+}
+
+func cellsEqual(a, b Cell) bool {
+	if a.IsNull() || b.IsNull() {
+		return a.IsNull() == b.IsNull()
+	}
+	return a.kind == b.kind && a.bits == b.bits && a.text == b.text && a.time.Equal(b.time)
+}
+
+func tuplesEqual(a, b []Cell) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !cellsEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func tupleUid(tuple []Cell) string {
+	uid := []byte{}
+	for _, c := range tuple {
+		uid = c.AppendUid(uid)
+	}
+	return string(uid)
+}
+
+func TestUidDistinctTuples(t *testing.T) {
+	property := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		a, b := randomTuple(r), randomTuple(r)
+		return (tupleUid(a) == tupleUid(b)) == tuplesEqual(a, b)
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 100000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUidCollisions(t *testing.T) {
+	cell := func(set func(c *Cell)) Cell {
+		c := Cell{}
+		set(&c)
+		return c
+	}
+	str := func(s string) Cell { return cell(func(c *Cell) { c.SetString(s) }) }
+	null := cell(func(c *Cell) { c.SetNull() })
+	utc := time.Date(2020, 1, 1, 10, 0, 0, 1, time.UTC)
+	cases := []struct {
+		name string
+		a, b []Cell
+	}{
+		{"concatenated strings", []Cell{str("1"), str("23")}, []Cell{str("12"), str("3")}},
+		{"null and text", []Cell{null}, []Cell{str("cnull")}},
+		{"empty string and null", []Cell{str("")}, []Cell{null}},
+		{"string and bytes", []Cell{str("ab")}, []Cell{cell(func(c *Cell) { c.SetBytes([]byte("ab")) })}},
+		{"int and float", []Cell{cell(func(c *Cell) { c.SetInt64(1) })}, []Cell{cell(func(c *Cell) { c.SetFloat64(1) })}},
+		{"bool and int", []Cell{cell(func(c *Cell) { c.SetBool(true) })}, []Cell{cell(func(c *Cell) { c.SetInt64(1) })}},
+		{"sub second time", []Cell{cell(func(c *Cell) { c.SetTime(utc) })}, []Cell{cell(func(c *Cell) { c.SetTime(utc.Add(time.Nanosecond)) })}},
+	}
+	for _, tc := range cases {
+		if tupleUid(tc.a) == tupleUid(tc.b) {
+			t.Errorf("%s: distinct tuples share the uid %q", tc.name, tupleUid(tc.a))
+		}
+	}
+
+	inZone := cell(func(c *Cell) { c.SetTime(utc.In(time.FixedZone("UTC+2", 2*60*60))) })
+	if inZone.Uid() != cell(func(c *Cell) { c.SetTime(utc) }).Uid() {
+		t.Error("same instants in different locations have different uids")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	src := []byte{0, 255, 'a'}
+	c := NewCell("BYTEA")
+	c.Scan(src)
+	src[0] = 1 // drivers may reuse the buffer
+	if d, err := c.Bytes(); err != nil || string(d) != string([]byte{0, 255, 'a'}) {
+		t.Errorf("got %v, %v", d, err)
+	}
+	if v, _ := c.Value(); string(v.([]byte)) != string([]byte{0, 255, 'a'}) {
+		t.Errorf("driver value: got %v", v)
+	}
+}
+
+func TestBoolFromText(t *testing.T) {
+	for text, want := range map[string]bool{"t": true, "f": false, "true": true, "1": true, "0": false} {
+		c := NewCell("BOOL")
+		c.Scan([]byte(text))
+		if got, err := c.Bool(); err != nil || got != want {
+			t.Errorf("%q: got %v, %v, want %v", text, got, err, want)
+		}
+	}
+}
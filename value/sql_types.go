@@ -11,8 +11,8 @@ import (
 // Value represents go data types which carta supports for loading as well as what data types arrive from the sql driver
 type Value int
 
-// NOTE, carta does NOT support loading []uint8, any data that arrives from sql database as []uint8
-//is converted to bytes and expected field type is a string or *string
+// Data that arrives from the sql database as []uint8 can be loaded to strings as well as
+// []byte, json.RawMessage and fixed size byte arrays, see IsBytes
 const (
 	Invalid Value = iota
 	Time
@@ -37,6 +37,7 @@ const (
 	Uint64
 	Bool
 	String //  note, []uint8get converted to string, this is because mysql returns []uint8 for varchar while pg returns string
+	Bytes
 )
 
 var BasicKinds = map[reflect.Kind]Value{
@@ -67,6 +68,12 @@ var BasicTypes = map[reflect.Type]Value{
 	reflect.TypeOf(sql.NullTime{}):        NullTime,
 }
 
+// IsBytes tests whether t is a slice or an array of bytes, ie []byte, json.RawMessage or [32]byte
+// such types are loaded as a single binary value rather than a collection
+func IsBytes(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
 var NullableTypes = map[reflect.Type]Value{
 	reflect.TypeOf(sql.NullBool{}):    NullBool,
 	reflect.TypeOf(sql.NullFloat64{}): NullFloat64,
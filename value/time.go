@@ -0,0 +1,103 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeParser parses time values which arrive as text, for example from MySQL without "parseTime=true" or from SQLite.
+// Layouts are keyed by the upper case database type name of the column and tried in order,
+// values of columns with an unlisted type name are parsed with DefaultLayouts.
+// Values without a time zone are parsed in Location, or in UTC if it is nil
+type TimeParser struct {
+	Layouts        map[string][]string
+	DefaultLayouts []string
+	Location       *time.Location
+}
+
+// NewTimeParser returns a parser with copies of the default layouts, which can be modified without affecting other parsers
+func NewTimeParser() *TimeParser {
+	p := &TimeParser{
+		Layouts:        make(map[string][]string, len(timeLayouts)),
+		DefaultLayouts: append([]string(nil), defaultTimeLayouts...),
+		Location:       time.UTC,
+	}
+	for typName, layouts := range timeLayouts {
+		p.Layouts[typName] = append([]string(nil), layouts...)
+	}
+	return p
+}
+
+// defaultTimeParser is used by cells without a parser, it is never modified
+var defaultTimeParser = NewTimeParser()
+
+var timeLayouts = map[string][]string{
+	"DATE": {
+		"2006-01-02",
+	},
+	"DATETIME": {
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02",
+	},
+	"TIMESTAMP": {
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02",
+	},
+	"TIMESTAMPTZ": {
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z07",
+		"2006-01-02T15:04:05.999999999Z07:00",
+	},
+	"TIME": {
+		"15:04:05.999999999",
+	},
+	"TIMETZ": {
+		"15:04:05.999999999Z07:00",
+		"15:04:05.999999999Z07",
+	},
+}
+
+var defaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+// ParseTime parses a time value which arrived as text with the default layouts, see TimeParser.Parse
+func ParseTime(colTypName string, text string) (time.Time, error) {
+	return defaultTimeParser.Parse(colTypName, text)
+}
+
+// Parse parses a time value which arrived as text, based on the database type name of its column
+// MySQL zero dates, ie "0000-00-00 00:00:00" are parsed as zero time
+func (p *TimeParser) Parse(colTypName string, text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	layouts, ok := p.Layouts[strings.ToUpper(colTypName)]
+	if !ok {
+		layouts = p.DefaultLayouts
+	}
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as time of column type %q", text, colTypName)
+}
@@ -0,0 +1,66 @@
+package value
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	cases := []struct {
+		colTypName string
+		text       string
+		want       time.Time
+	}{
+		{"DATE", "2004-10-19", time.Date(2004, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"DATETIME", "2004-10-19 10:23:54", time.Date(2004, 10, 19, 10, 23, 54, 0, time.UTC)},
+		{"DATETIME", "2004-10-19 10:23:54.123456", time.Date(2004, 10, 19, 10, 23, 54, 123456000, time.UTC)},
+		{"timestamp", "2004-10-19T10:23:54", time.Date(2004, 10, 19, 10, 23, 54, 0, time.UTC)},
+		{"TIMESTAMPTZ", "2004-10-19 10:23:54+02", time.Date(2004, 10, 19, 8, 23, 54, 0, time.UTC)},
+		{"TIME", "04:05:06", time.Date(0, 1, 1, 4, 5, 6, 0, time.UTC)},
+		{"TIMETZ", "04:05:06-08", time.Date(0, 1, 1, 12, 5, 6, 0, time.UTC)},
+		{"", "2004-10-19T10:23:54.5Z", time.Date(2004, 10, 19, 10, 23, 54, 500000000, time.UTC)},
+		{"DATETIME", "0000-00-00 00:00:00", time.Time{}},
+	}
+	for _, tc := range cases {
+		got, err := ParseTime(tc.colTypName, tc.text)
+		if err != nil {
+			t.Errorf("%s %q: %s", tc.colTypName, tc.text, err)
+		} else if !got.Equal(tc.want) {
+			t.Errorf("%s %q: got %s, want %s", tc.colTypName, tc.text, got, tc.want)
+		}
+	}
+	if _, err := ParseTime("DATE", "19 Oct 2004"); err == nil {
+		t.Error("expected error for text not matching any layout")
+	}
+}
+
+func TestTimeFromText(t *testing.T) {
+	c := NewCell("DATETIME")
+	c.Scan([]byte("2004-10-19 10:23:54"))
+	want := time.Date(2004, 10, 19, 10, 23, 54, 0, time.UTC)
+	if d, err := c.NullTime(); err != nil || !d.Valid || !d.Time.Equal(want) {
+		t.Errorf("null time: got %v, %v", d, err)
+	}
+	if d, err := c.TimestampProto(); err != nil || d.Seconds != want.Unix() {
+		t.Errorf("timestamp: got %v, %v", d, err)
+	}
+}
+
+func TestTimeParser(t *testing.T) {
+	p := NewTimeParser()
+	p.Location = time.FixedZone("UTC+2", 2*60*60)
+	p.Layouts["DATE"] = []string{"02/01/2006"}
+	c := NewCellWithTimeParser("DATE", p)
+	c.Scan([]byte("19/10/2004"))
+	want := time.Date(2004, 10, 18, 22, 0, 0, 0, time.UTC)
+	if d, err := c.Time(); err != nil || !d.Equal(want) {
+		t.Errorf("time: got %v, %v", d, err)
+	}
+	// the default layouts are not affected
+	if _, err := ParseTime("DATE", "2004-10-19"); err != nil {
+		t.Errorf("default layouts: %s", err)
+	}
+	if _, err := NewTimeParser().Parse("DATE", "19/10/2004"); err == nil {
+		t.Error("expected error for text not matching the layouts of a new parser")
+	}
+}
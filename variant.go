@@ -0,0 +1,170 @@
+package carta
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/jackskj/carta/value"
+)
+
+// Polymorphic has-one and has-many relationships are mapped onto fields of interface types, ie PaymentMethod or []PaymentMethod,
+// concrete types of the interface are registered with RegisterVariant, each under a value of a discriminator column.
+// The discriminator column is "kind" unless named with the "discriminator=column" tag option of the field,
+// ancestor prefixes apply to the discriminator column as they do to any other column, ie "payment_kind".
+//
+// Every variant allocates columns on its own, since only one variant is loaded from a row, variants can share columns.
+// Rows with a null discriminator, ie from outer joins, are skipped, unknown discriminator values are an error.
+
+const defaultDiscriminator = "kind"
+
+var (
+	variants   sync.Map   // reflect.Type of an interface to map[string]reflect.Type
+	variantsMu sync.Mutex // serializes registrations
+)
+
+// RegisterVariant registers a concrete type of an interface, loaded from rows with the discriminator value
+// iface must be a nil pointer to the interface, and variant a struct, or a pointer to a struct, which implements it
+// carta.RegisterVariant((*PaymentMethod)(nil), "card", Card{})
+// carta.RegisterVariant((*PaymentMethod)(nil), "iban", &BankAccount{})
+//
+// Mappers are cached, therefore variants should be registered before mapping, ie in init
+func RegisterVariant(iface interface{}, discriminator string, variant interface{}) {
+	ifaceTyp := reflect.TypeOf(iface)
+	if ifaceTyp == nil || ifaceTyp.Kind() != reflect.Ptr || ifaceTyp.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprintf("carta: RegisterVariant expects a nil pointer to an interface, got %T", iface))
+	}
+	ifaceTyp = ifaceTyp.Elem()
+	variantTyp := reflect.TypeOf(variant)
+	if variantTyp == nil || !(variantTyp.Kind() == reflect.Struct || isStructPtr(variantTyp)) {
+		panic(fmt.Sprintf("carta: variant of %s must be a struct or a pointer to a struct, got %T", ifaceTyp, variant))
+	}
+	if !variantTyp.Implements(ifaceTyp) {
+		panic(fmt.Sprintf("carta: variant %s does not implement %s", variantTyp, ifaceTyp))
+	}
+
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+	registered := map[string]reflect.Type{}
+	if v, ok := variants.Load(ifaceTyp); ok {
+		for d, t := range v.(map[string]reflect.Type) {
+			registered[d] = t
+		}
+	}
+	registered[discriminator] = variantTyp
+	variants.Store(ifaceTyp, registered)
+}
+
+func variantsOf(t reflect.Type) (map[string]reflect.Type, bool) {
+	if t.Kind() != reflect.Interface {
+		return nil, false
+	}
+	if v, ok := variants.Load(t); ok {
+		return v.(map[string]reflect.Type), true
+	}
+	return nil, false
+}
+
+func isPolymorphic(t reflect.Type) bool {
+	_, ok := variantsOf(t)
+	return ok
+}
+
+// newVariantMappers generates a mapper for every registered variant of the interface mapper
+func newVariantMappers(m *Mapper) error {
+	registered, _ := variantsOf(m.Typ)
+	m.variants = map[string]*Mapper{}
+	for discriminator, typ := range registered {
+		variant, err := newMapper(typ, m.types, m.maxDepth)
+		if err == errDepthLimit {
+			// recursion ends, the variant is not loaded at this depth
+			continue
+		} else if err != nil {
+			return err
+		}
+		m.variants[discriminator] = variant
+	}
+	return nil
+}
+
+func (m *Mapper) sortedVariants() []string {
+	discriminators := make([]string, 0, len(m.variants))
+	for d := range m.variants {
+		discriminators = append(discriminators, d)
+	}
+	sort.Strings(discriminators)
+	return discriminators
+}
+
+// allocateVariantColumns claims the discriminator column, then every variant allocates columns from a copy of the remaining ones,
+// columns claimed by any variant are not available to other mappers
+func allocateVariantColumns(m *Mapper, columns map[string]column, all map[string]column) error {
+	c, ok := m.claimColumn(m.discriminator, columns)
+	if !ok {
+		return fmt.Errorf("carta: discriminator column %s of %s not found", m.discriminator, m.path)
+	}
+	m.PresentColumns = map[string]column{c.name: c}
+	m.SortedColumnIndexes = []int{c.columnIndex}
+
+	claimed := map[string]bool{}
+	for _, discriminator := range m.sortedVariants() {
+		variant := m.variants[discriminator]
+		pool := make(map[string]column, len(columns))
+		for name, c := range columns {
+			pool[name] = c
+		}
+		variant.AncestorNames = append([]string{}, m.AncestorNames...)
+		if err := allocatePoolColumns(variant, pool, all); err != nil {
+			return err
+		}
+		for name := range columns {
+			if _, ok := pool[name]; !ok {
+				claimed[name] = true
+			}
+		}
+	}
+	for name := range claimed {
+		delete(columns, name)
+	}
+	return nil
+}
+
+// variantFor returns the variant mapper for the discriminator cell, nil if the discriminator is null
+func (m *Mapper) variantFor(cell *value.Cell) (*Mapper, error) {
+	if cell.IsNull() {
+		return nil, nil
+	}
+	v, err := cell.Value()
+	if err != nil {
+		return nil, err
+	}
+	discriminator := fmt.Sprint(v)
+	if b, ok := v.([]byte); ok {
+		discriminator = string(b)
+	}
+	variant, ok := m.variants[discriminator]
+	if !ok {
+		return nil, fmt.Errorf("carta: unknown discriminator %q of %s, register the variant with carta.RegisterVariant", discriminator, m.path)
+	}
+	return variant, nil
+}
+
+// elementUid generates the unique id of the element of the row, as well as the mapper of the element,
+// which is a variant mapper for polymorphic mappers, the returned mapper is nil if the row holds no variant
+func elementUid(m *Mapper, row []interface{}) (uniqueValId, *Mapper, error) {
+	if m.variants == nil {
+		return getUniqueId(row, m), m, nil
+	}
+	cell := row[m.SortedColumnIndexes[0]].(*value.Cell)
+	variant, err := m.variantFor(cell)
+	if variant == nil || err != nil {
+		return "", nil, err
+	}
+	// elements of distinct variants are distinct
+	uid := cell.AppendUid(nil)
+	for _, i := range variant.SortedColumnIndexes {
+		uid = row[i].(*value.Cell).AppendUid(uid)
+	}
+	return uniqueValId(uid), variant, nil
+}